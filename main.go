@@ -1,25 +1,77 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/MartianGreed/memo-backend/pkg/api"
+	"github.com/MartianGreed/memo-backend/pkg/cache"
 	"github.com/MartianGreed/memo-backend/pkg/data"
 	"github.com/MartianGreed/memo-backend/pkg/game"
+	"github.com/MartianGreed/memo-backend/pkg/indexer"
+	"github.com/MartianGreed/memo-backend/pkg/metrics"
+	"github.com/MartianGreed/memo-backend/pkg/ratelimit"
+	"github.com/MartianGreed/memo-backend/pkg/signer"
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+	"github.com/MartianGreed/memo-backend/pkg/tracing"
+	"github.com/NethermindEth/juno/core/felt"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/websocket"
 )
 
+const (
+	collectionLoadTimeout  = 2 * time.Minute
+	metadataCacheTTL       = 24 * time.Hour
+	rpcVerifyTimeout       = 30 * time.Second
+	rpcHealthCheckInterval = time.Minute
+	// deadline to check the key announced by a player against its account
+	playerVerifyTimeout   = 10 * time.Second
+	indexerCheckpointFile = "data/indexer.json"
+	// unfinished rooms without players are dropped after roomIdleTimeout,
+	// finished ones once their result was available for finishedRoomRetention
+	roomExpiryInterval    = time.Minute
+	roomIdleTimeout       = 30 * time.Minute
+	finishedRoomRetention = time.Hour
+	// players are told to come back once another machine took over
+	shutdownReconnectHint  = 5 * time.Second
+	defaultShutdownTimeout = 20 * time.Second
+)
+
 var (
-	connectionPool = game.NewConnectionPool()
-	board          *game.Board
+	defaultRpcLimit      = ratelimit.Limit{RPM: 600, Burst: 10, Concurrency: 8}
+	defaultMetadataLimit = ratelimit.Limit{RPM: 300, Burst: 5, Concurrency: 4}
 )
 
+var rooms = api.NewRooms()
+
+// accounts answers the public key of the accounts players claim in their hello
+var accounts starknet.StarknetRpcClient
+
+// players join the room given by the room query parameter, the default room otherwise
 func hello(c echo.Context) error {
+	room, ok := rooms.Lookup(c.QueryParam("room"))
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "room not found")
+	}
+	board, connectionPool := room.Board, room.Pool
 	websocket.Handler(func(ws *websocket.Conn) {
 		defer ws.Close()
 
@@ -30,17 +82,23 @@ func hello(c echo.Context) error {
 			c.Logger().Error(err)
 		}
 
-		connectionPool.Lock()
-		// execute join(contract_address: string, name: uuid) onchain to register user with wallet address
-		connectionPool.Connections[ws] = &game.ConnectionBuf{Name: userHello.Name}
-
-		defer func(connection *websocket.Conn) {
-			connectionPool.Lock()
-			delete(connectionPool.Connections, connection)
-			connectionPool.Unlock()
-		}(ws)
+		// a player whose key is not the one of its account plays anonymously
+		ctx, cancel := context.WithTimeout(ws.Request().Context(), playerVerifyTimeout)
+		player, err := userHello.Player(ctx, accounts)
+		cancel()
+		if err != nil {
+			slog.Warn("player plays anonymously", "error", err)
+		}
 
-		connectionPool.Unlock()
+		// execute join(contract_address: string, name: uuid) onchain to register user with wallet address
+		if !connectionPool.Join(ws, &game.ConnectionBuf{Name: userHello.Name}, player) {
+			// the room is being drained
+			_ = websocket.JSON.Send(ws, game.NewShutdownMessage(shutdownReconnectHint))
+			return
+		}
+		defer connectionPool.Leave(ws)
+		metrics.WsConnects.Inc()
+		defer metrics.WsDisconnects.Inc()
 
 		// on connection send the current board with revealed tiles
 		// user.hover-card
@@ -59,53 +117,298 @@ func hello(c echo.Context) error {
 			c.Logger().Error(err)
 		}
 
+		// clients may send a traceparent header with the upgrade request
+		connCtx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(ws.Request().Header))
 		for {
 			// Read
 			var userAction game.UserAction
 			err := websocket.JSON.Receive(ws, &userAction)
-			if err != nil && err.Error() != "EOF" {
-				c.Logger().Error(err)
+			if err != nil {
+				// a malformed message does not end the connection
+				var syntaxErr *json.SyntaxError
+				var typeErr *json.UnmarshalTypeError
+				if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+					c.Logger().Error(err)
+					continue
+				}
+				// closed by the client or by the shutdown
+				if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+					c.Logger().Error(err)
+				}
+				return
 			}
 
-			err = game.HandleMessage(userAction, board, ws, connectionPool)
+			ctx, span := tracing.Tracer().Start(connCtx, "ws.receive", trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+				attribute.String("game.room", room.Id),
+				attribute.String("game.event", userAction.Event),
+			))
+			err = game.HandleMessage(ctx, userAction, board, ws, connectionPool)
 			if err != nil {
 				c.Logger().Error(err)
 			}
+			tracing.End(span, err)
 		}
 	}).ServeHTTP(c.Response(), c.Request())
 	return nil
 }
 
 func main() {
+	// SIGTERM during startup aborts the loading, afterwards it drains the server
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.ConfigFromEnv())
+	if err != nil {
+		slog.Error("tracing disabled", "error", err)
+		shutdownTracing = func(context.Context) error { return nil }
+	}
+
 	e := echo.New()
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 
+	// listen right away so probes can follow the startup, every other route
+	// answers 503 until the board is ready
+	health := api.NewHealth(rooms)
+	health.Register(e)
+	e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+	e.Use(health.RequireReady)
+	e.GET("/ws", hello)
+	apiServer := api.NewServer(rooms, nil, nil)
+	apiServer.Register(e)
+	go func() {
+		if err := e.Start(":8000"); err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	// server identity, signs the onchain game transactions
+	serverSigner, err := signer.FromEnv()
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	slog.Info("server signer", "public_key", serverSigner.PublicKey().String())
+
+	game.RequireSignedMoves = os.Getenv("REQUIRE_SIGNED_MOVES") == "true"
+
 	// execute spawn() to create board onchain
-	collection := data.LoadCollection()
+	registry, err := data.RegistryFromEnv()
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	collectionId := os.Getenv("COLLECTION")
+	if collectionId == "" {
+		collectionId = data.DefaultCollectionId
+	}
+	config, err := registry.Get(collectionId)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	rpc, err := starknet.NewClientFromEnv()
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	if config.Network != rpc.Network {
+		e.Logger.Fatalf("collection %s lives on %s but NETWORK is %s", config.Id, config.Network, rpc.Network)
+	}
+	// every outbound request goes through the same per host limiters
+	rpcLimits := make(map[string]ratelimit.Limit)
+	for _, endpoint := range rpc.Endpoints {
+		rpcLimits[endpointHost(endpoint.Url)] = ratelimit.LimitFromEnv("RPC", defaultRpcLimit)
+	}
+	transport := ratelimit.NewTransport(nil, ratelimit.LimitFromEnv("METADATA", defaultMetadataLimit), rpcLimits)
+	rpc.Client = transport.Wrap(rpc.Client)
+	health.SetRpc(rpc)
+	accounts = rpc
 
-	if board == nil {
-		// fetch Tile collection
-		// create board from fetched tiles
-		board = game.CreateBoard(collection)
+	ctx, cancel := context.WithTimeout(signalCtx, rpcVerifyTimeout)
+	err = rpc.VerifyChainId(ctx)
+	cancel()
+	if err != nil {
+		e.Logger.Fatal(err)
 	}
+	// background workers live as long as the server, they are waited for on shutdown
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	var background sync.WaitGroup
+	rpc.StartHealthChecks(backgroundCtx, rpcHealthCheckInterval)
+	fetcher := data.NewHttpFetcher()
+	fetcher.Client = transport.Wrap(fetcher.Client)
 
-	e.GET("/ws", hello)
+	opts := data.DefaultLoadOptions
+	opts.Cache = cache.New("data", metadataCacheTTL)
+	opts.RenderImages = true
+	opts.Resolver = data.NewResolver(fetcher)
+	ctx, cancel = context.WithTimeout(signalCtx, collectionLoadTimeout)
+	collection, report, err := data.LoadCollection(ctx, rpc, config, opts)
+	cancel()
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	health.SetCollection(config.Id, report)
+	if !report.Complete() {
+		slog.Warn("collection partially loaded", "id", config.Id, "failed", report.FailedIds())
+	}
+	for host, stats := range transport.Stats() {
+		slog.Info("rate limiter", "host", host, "requests", stats.Requests, "throttled", stats.Throttled, "total_wait", stats.TotalWait, "max_wait", stats.MaxWait)
+	}
 
-	e.Logger.Fatal(e.Start(":8000"))
+	chainId, err := starknet.ChainId(rpc.Network)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(signalCtx, rpcVerifyTimeout)
+	seed, err := newSeed(ctx, rpc)
+	cancel()
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	// fetch Tile collection
+	// create board from fetched tiles
+	board, err := game.CreateBoard(collection, seed)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	board.ChainId = chainId
+	rooms.Add(api.NewRoom(board))
+	slog.Info("board created", "commitment", board.Commitment.String())
 
-	go gracefulShutdown()
-	forever := make(chan int)
-	<-forever
+	if contract := os.Getenv("GAME_CONTRACT"); contract != "" {
+		if err := startIndexer(backgroundCtx, &background, rpc, contract); err != nil {
+			e.Logger.Fatal(err)
+		}
+	}
+
+	apiServer.Collection = collection
+	apiServer.ChainId = chainId
+	if maxRooms := os.Getenv("MAX_ROOMS"); maxRooms != "" {
+		if apiServer.MaxRooms, err = strconv.Atoi(maxRooms); err != nil {
+			e.Logger.Fatal(err)
+		}
+	}
+	apiServer.Creations = ratelimit.NewLimiter(ratelimit.LimitFromEnv("ROOMS", api.DefaultCreateLimit))
+	rooms.StartExpiry(backgroundCtx, roomExpiryInterval, roomIdleTimeout, finishedRoomRetention)
+	// created rooms are seeded like the default one
+	apiServer.NewSeed = func(ctx context.Context) (game.Seed, error) { return newSeed(ctx, rpc) }
+	health.MarkReady()
+	slog.Info("server ready")
+
+	<-signalCtx.Done()
+	stopSignals()
+	timeout := shutdownTimeout()
+	slog.Info("shutting down", "timeout", timeout)
+	ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// new sockets get a 503 then the listener is closed, open websockets are
+	// hijacked connections Shutdown does not wait for
+	health.MarkDraining()
+	if err := e.Shutdown(ctx); err != nil {
+		slog.Error("http shutdown", "error", err)
+	}
+	if err := rooms.Shutdown(ctx, shutdownReconnectHint); err != nil {
+		slog.Error("rooms shutdown", "error", err)
+	}
+	// moves are not submitted onchain yet, the indexer checkpoint is the only
+	// state written in the background
+	stopBackground()
+	if err := wait(ctx, &background); err != nil {
+		slog.Error("background workers shutdown", "error", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("tracing shutdown", "error", err)
+	}
+	slog.Info("server stopped")
+}
+
+// SHUTDOWN_TIMEOUT bounds the whole shutdown, it must stay below the kill
+// timeout of the platform
+func shutdownTimeout() time.Duration {
+	timeout, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		return defaultShutdownTimeout
+	}
+	return timeout
+}
+
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func endpointHost(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	return u.Host
 }
 
-func gracefulShutdown() {
-	s := make(chan os.Signal, 1)
-	signal.Notify(s, os.Interrupt)
-	signal.Notify(s, syscall.SIGTERM)
+// follow the game contract events, progress is kept next to the metadata cache
+func startIndexer(ctx context.Context, background *sync.WaitGroup, rpc *starknet.JsonRpcStarknetClient, contract string) error {
+	address, err := new(felt.Felt).SetString(contract)
+	if err != nil {
+		return err
+	}
+	ix, err := indexer.NewIndexer(rpc, address, indexerCheckpointFile, indexer.GameEvents...)
+	if err != nil {
+		return err
+	}
+	if start := os.Getenv("GAME_CONTRACT_START_BLOCK"); start != "" {
+		if ix.StartBlock, err = strconv.ParseUint(start, 10, 64); err != nil {
+			return err
+		}
+	}
+	ix.Handle(func(ev indexer.Event) {
+		slog.Info("game event", "name", ev.Name, "block", ev.BlockNumber, "tx", ev.TransactionHash)
+	})
+	background.Add(1)
 	go func() {
-		<-s
-		// clean up here
-		os.Exit(0)
+		defer background.Done()
+		if err := ix.Run(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("indexer stopped", "contract", contract, "error", err)
+		}
 	}()
+	return nil
+}
+
+// server seed is always random, CLIENT_SEED can be provided to mix in external
+// entropy and SEED_BLOCK (latest, a block number or hash) to mix in a block hash
+func newSeed(ctx context.Context, rpc *starknet.JsonRpcStarknetClient) (game.Seed, error) {
+	serverSeed, err := game.NewServerSeed()
+	if err != nil {
+		return game.Seed{}, err
+	}
+	seed := game.Seed{Server: serverSeed}
+	if clientSeed := os.Getenv("CLIENT_SEED"); clientSeed != "" {
+		seed.Client, err = new(felt.Felt).SetString(clientSeed)
+		if err != nil {
+			return game.Seed{}, err
+		}
+	}
+	if blockId := os.Getenv("SEED_BLOCK"); blockId != "" {
+		id, err := starknet.ParseBlockId(blockId)
+		if err != nil {
+			return game.Seed{}, err
+		}
+		block, err := rpc.GetBlockWithTxHashes(ctx, id)
+		if err != nil {
+			return game.Seed{}, err
+		}
+		if block.BlockHash == nil {
+			return game.Seed{}, fmt.Errorf("block %s has no hash yet", blockId)
+		}
+		seed.BlockHash = block.BlockHash
+		slog.Info("seeding board from block", "number", block.BlockNumber, "hash", block.BlockHash.String())
+	}
+	return seed, nil
 }
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/labstack/echo/v4"
+
+	"github.com/MartianGreed/memo-backend/pkg/data"
+	"github.com/MartianGreed/memo-backend/pkg/game"
+	"github.com/MartianGreed/memo-backend/pkg/ratelimit"
+)
+
+type (
+	RoomSummary struct {
+		Id           string     `json:"id"`
+		CollectionId string     `json:"collection_id"`
+		Commitment   *felt.Felt `json:"commitment"`
+		Players      int        `json:"players"`
+		Finished     bool       `json:"finished"`
+		CreatedAt    time.Time  `json:"created_at"`
+	}
+	BoardState struct {
+		Id           string        `json:"id"`
+		CollectionId string        `json:"collection_id"`
+		Commitment   *felt.Felt    `json:"commitment"`
+		ChainId      *felt.Felt    `json:"chain_id"`
+		Revealed     [][]game.Tile `json:"revealed"`
+		PublicKeys   []*felt.Felt  `json:"public_keys"`
+		Finished     bool          `json:"finished"`
+	}
+	RoomPlayer struct {
+		Name       string     `json:"name"`
+		Account    *felt.Felt `json:"account,omitempty"`
+		PublicKey  *felt.Felt `json:"public_key,omitempty"`
+		SessionKey *felt.Felt `json:"session_key,omitempty"`
+		Moves      int        `json:"moves"`
+	}
+	PlayerProfile struct {
+		Account *felt.Felt `json:"account"`
+		// rooms the player signed moves in
+		Rooms     []string `json:"rooms"`
+		Moves     int      `json:"moves"`
+		Connected bool     `json:"connected"`
+	}
+	GameResult struct {
+		Id         string            `json:"id"`
+		Seed       game.Seed         `json:"seed"`
+		Layout     [][]int           `json:"layout"`
+		PublicKeys []*felt.Felt      `json:"public_keys"`
+		Moves      []game.SignedMove `json:"moves"`
+		Proofs     []game.MatchProof `json:"proofs"`
+	}
+	ReplayResponse struct {
+		Commitment *felt.Felt   `json:"commitment"`
+		Layout     [][]int      `json:"layout"`
+		PublicKeys []*felt.Felt `json:"public_keys"`
+	}
+	CollectionResponse struct {
+		Config data.CollectionConfig `json:"config"`
+		Tokens []data.Attributes     `json:"tokens"`
+	}
+)
+
+// DefaultMaxRooms bounds the unfinished rooms clients can create
+const DefaultMaxRooms = 32
+
+// DefaultCreateLimit is the rate at which clients can create rooms
+var DefaultCreateLimit = ratelimit.Limit{RPM: 30, Burst: 5}
+
+// Server serves the JSON api over the rooms
+type Server struct {
+	Rooms      *Rooms
+	Collection *data.Collection
+	ChainId    *felt.Felt
+	// NewSeed seeds the boards of created rooms
+	NewSeed func(ctx context.Context) (game.Seed, error)
+	// MaxRooms is the number of unfinished rooms above which POST /rooms is
+	// refused, zero disables the limit
+	MaxRooms int
+	// Creations rate limits POST /rooms, nil disables it
+	Creations *ratelimit.Limiter
+}
+
+func NewServer(rooms *Rooms, collection *data.Collection, chainId *felt.Felt) *Server {
+	return &Server{
+		Rooms:      rooms,
+		Collection: collection,
+		ChainId:    chainId,
+		NewSeed: func(context.Context) (game.Seed, error) {
+			serverSeed, err := game.NewServerSeed()
+			return game.Seed{Server: serverSeed}, err
+		},
+		MaxRooms:  DefaultMaxRooms,
+		Creations: ratelimit.NewLimiter(DefaultCreateLimit),
+	}
+}
+
+// Register adds every route of the api to e
+func (s *Server) Register(e *echo.Echo) {
+	for _, r := range s.routes() {
+		e.Add(r.Method, r.Path, r.Handler)
+	}
+}
+
+func (s *Server) room(c echo.Context) (*Room, error) {
+	room, ok := s.Rooms.Lookup(c.Param("id"))
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "room not found")
+	}
+	return room, nil
+}
+
+func summary(room *Room) RoomSummary {
+	room.Pool.RLock()
+	players := len(room.Pool.Connections)
+	room.Pool.RUnlock()
+	return RoomSummary{
+		Id:           room.Id,
+		CollectionId: room.Board.CollectionId,
+		Commitment:   room.Board.Commitment,
+		Players:      players,
+		Finished:     room.Board.Finished(),
+		CreatedAt:    room.CreatedAt,
+	}
+}
+
+func (s *Server) listRooms(c echo.Context) error {
+	rooms := s.Rooms.List()
+	summaries := make([]RoomSummary, len(rooms))
+	for i, room := range rooms {
+		summaries[i] = summary(room)
+	}
+	return c.JSON(http.StatusOK, summaries)
+}
+
+// a new room gets its own board from the loaded collection
+func (s *Server) createRoom(c echo.Context) error {
+	if s.Creations != nil {
+		release, ok := s.Creations.TryAcquire()
+		if !ok {
+			return echo.NewHTTPError(http.StatusTooManyRequests, "too many rooms created")
+		}
+		defer release()
+	}
+	seed, err := s.NewSeed(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	board, err := game.CreateBoard(s.Collection, seed)
+	if err != nil {
+		return err
+	}
+	board.ChainId = s.ChainId
+	room := NewRoom(board)
+	if !s.Rooms.TryAdd(room, s.MaxRooms) {
+		return echo.NewHTTPError(http.StatusTooManyRequests, "too many rooms being played")
+	}
+	return c.JSON(http.StatusCreated, summary(room))
+}
+
+func (s *Server) getBoard(c echo.Context) error {
+	room, err := s.room(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, BoardState{
+		Id:           room.Id,
+		CollectionId: room.Board.CollectionId,
+		Commitment:   room.Board.Commitment,
+		ChainId:      room.Board.ChainId,
+		Revealed:     room.Board.RevealedTiles(),
+		PublicKeys:   room.Board.PublicKeys(),
+		Finished:     room.Board.Finished(),
+	})
+}
+
+func (s *Server) listPlayers(c echo.Context) error {
+	room, err := s.room(c)
+	if err != nil {
+		return err
+	}
+	room.Pool.RLock()
+	defer room.Pool.RUnlock()
+	players := []RoomPlayer{}
+	for ws, buf := range room.Pool.Connections {
+		p := RoomPlayer{Name: buf.Name}
+		if player, ok := room.Pool.Players[ws]; ok {
+			p.Account = player.Account
+			p.PublicKey = player.PublicKey
+			p.SessionKey = player.SessionKey()
+			p.Moves = player.MoveCount()
+		}
+		players = append(players, p)
+	}
+	return c.JSON(http.StatusOK, players)
+}
+
+// profile of an account built from the signed moves of every room
+func (s *Server) getPlayer(c echo.Context) error {
+	account, err := new(felt.Felt).SetString(c.Param("account"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid account")
+	}
+	profile := PlayerProfile{Account: account, Rooms: []string{}}
+	for _, room := range s.Rooms.List() {
+		played := false
+		for _, m := range room.Board.Moves() {
+			if m.Account.Equal(account) {
+				profile.Moves++
+				played = true
+			}
+		}
+		room.Pool.RLock()
+		for _, player := range room.Pool.Players {
+			if player.Account.Equal(account) {
+				profile.Connected = true
+			}
+		}
+		room.Pool.RUnlock()
+		if played {
+			profile.Rooms = append(profile.Rooms, room.Id)
+		}
+	}
+	if profile.Moves == 0 && !profile.Connected {
+		return echo.NewHTTPError(http.StatusNotFound, "player not found")
+	}
+	return c.JSON(http.StatusOK, profile)
+}
+
+func (s *Server) listMoves(c echo.Context) error {
+	room, err := s.room(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, room.Board.Moves())
+}
+
+// reveal the seeds used to generate the board once the game has finished
+func (s *Server) revealSeed(c echo.Context) error {
+	room, err := s.room(c)
+	if err != nil {
+		return err
+	}
+	seed, err := room.Board.RevealSeed()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return c.JSON(http.StatusOK, seed)
+}
+
+// everything needed to audit a finished game
+func (s *Server) getResult(c echo.Context) error {
+	room, err := s.room(c)
+	if err != nil {
+		return err
+	}
+	seed, err := room.Board.RevealSeed()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	proofs, err := room.Board.MatchProofs()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return c.JSON(http.StatusOK, GameResult{
+		Id:         room.Id,
+		Seed:       seed,
+		Layout:     room.Board.Layout(),
+		PublicKeys: room.Board.PublicKeys(),
+		Moves:      room.Board.Moves(),
+		Proofs:     proofs,
+	})
+}
+
+// regenerate the board layout from revealed seeds
+func (s *Server) replayBoard(c echo.Context) error {
+	var seed game.Seed
+	if err := c.Bind(&seed); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	replay, err := game.CreateBoard(s.Collection, seed)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, ReplayResponse{
+		Commitment: replay.Commitment,
+		Layout:     replay.Layout(),
+		PublicKeys: replay.PublicKeys(),
+	})
+}
+
+func (s *Server) getCollection(c echo.Context) error {
+	ids := s.Collection.TokenIds()
+	tokens := make([]data.Attributes, len(ids))
+	for i, id := range ids {
+		tokens[i] = s.Collection.Get(id)
+	}
+	return c.JSON(http.StatusOK, CollectionResponse{Config: s.Collection.Config(), Tokens: tokens})
+}
+
+func (s *Server) getOpenApi(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.OpenApi())
+}
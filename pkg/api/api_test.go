@@ -0,0 +1,263 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/MartianGreed/memo-backend/pkg/data"
+	"github.com/MartianGreed/memo-backend/pkg/game"
+	"github.com/MartianGreed/memo-backend/pkg/ratelimit"
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+)
+
+func testServer(t *testing.T) (*echo.Echo, *Server, *Room) {
+	t.Helper()
+	var attrs []data.Attributes
+	for i := 1; i <= 40; i++ {
+		attrs = append(attrs, data.Attributes{Name: fmt.Sprintf("blobert #%d", i), TokenId: i})
+	}
+	collection := data.NewCollection(data.Blobert, attrs...)
+	chainId, _ := starknet.ChainId(starknet.Mainnet)
+
+	board, err := game.CreateBoard(collection, game.Seed{Server: starknet.FeltFromInt(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	board.ChainId = chainId
+	rooms := NewRooms()
+	room := NewRoom(board)
+	rooms.Add(room)
+
+	s := NewServer(rooms, collection, chainId)
+	e := echo.New()
+	s.Register(e)
+	return e, s, room
+}
+
+func do(t *testing.T, e *echo.Echo, method string, path string, body string, v any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if v != nil && rec.Code < 300 {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, path, err, rec.Body)
+		}
+	}
+	return rec.Code
+}
+
+func finish(b *game.Board) {
+	for i := range b.Revealed {
+		for j := range b.Revealed[i] {
+			b.Revealed[i][j].Revealed = true
+		}
+	}
+}
+
+func TestRooms(t *testing.T) {
+	e, _, room := testServer(t)
+
+	var created RoomSummary
+	if code := do(t, e, http.MethodPost, "/rooms", "", &created); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if created.Id == room.Id || created.CollectionId != data.DefaultCollectionId {
+		t.Fatalf("unexpected room %+v", created)
+	}
+
+	var rooms []RoomSummary
+	if code := do(t, e, http.MethodGet, "/rooms", "", &rooms); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if len(rooms) != 2 || rooms[0].Id != room.Id || rooms[1].Id != created.Id {
+		t.Fatalf("unexpected rooms %+v", rooms)
+	}
+
+	var state BoardState
+	if code := do(t, e, http.MethodGet, "/rooms/"+created.Id, "", &state); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if len(state.PublicKeys) != game.Rows*game.Cols || len(state.Revealed) != game.Rows || state.ChainId == nil {
+		t.Fatalf("unexpected board state %+v", state)
+	}
+	if code := do(t, e, http.MethodGet, "/rooms/0x404", "", nil); code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", code)
+	}
+
+	var players []RoomPlayer
+	if code := do(t, e, http.MethodGet, "/rooms/"+room.Id+"/players", "", &players); code != http.StatusOK || len(players) != 0 {
+		t.Fatalf("expected no players, got %d %v", code, players)
+	}
+}
+
+func TestRoomLimit(t *testing.T) {
+	e, s, room := testServer(t)
+	s.MaxRooms = 2
+
+	if code := do(t, e, http.MethodPost, "/rooms", "", nil); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if code := do(t, e, http.MethodPost, "/rooms", "", nil); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the limit is reached, got %d", code)
+	}
+	// finished rooms do not count
+	finish(room.Board)
+	if code := do(t, e, http.MethodPost, "/rooms", "", nil); code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", code)
+	}
+}
+
+func TestRoomCreationIsRateLimited(t *testing.T) {
+	e, s, _ := testServer(t)
+	s.Creations = ratelimit.NewLimiter(ratelimit.Limit{RPM: 1, Burst: 2})
+
+	for i := 0; i < 2; i++ {
+		if code := do(t, e, http.MethodPost, "/rooms", "", nil); code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d", code)
+		}
+	}
+	if code := do(t, e, http.MethodPost, "/rooms", "", nil); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the burst is spent, got %d", code)
+	}
+}
+
+func TestRoomExpiry(t *testing.T) {
+	e, s, room := testServer(t)
+	var abandoned, played, finished RoomSummary
+	for _, created := range []*RoomSummary{&abandoned, &played, &finished} {
+		if code := do(t, e, http.MethodPost, "/rooms", "", created); code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d", code)
+		}
+	}
+	get := func(id string) *Room {
+		r, ok := s.Rooms.Get(id)
+		if !ok {
+			t.Fatalf("room %s is missing", id)
+		}
+		return r
+	}
+	get(played.Id).Pool.Connections[nil] = &game.ConnectionBuf{Name: "alice"}
+	finish(get(finished.Id).Board)
+	// the default room is never expired, even once abandoned
+	finish(room.Board)
+
+	now := time.Now()
+	if expired := s.Rooms.Expire(now, time.Minute, time.Hour); len(expired) != 0 {
+		t.Fatalf("expected no room to expire yet, got %d", len(expired))
+	}
+	now = now.Add(2 * time.Minute)
+	expired := s.Rooms.Expire(now, time.Minute, time.Hour)
+	if len(expired) != 1 || expired[0].Id != abandoned.Id {
+		t.Fatalf("expected the abandoned room to expire, got %v", expired)
+	}
+	if code := do(t, e, http.MethodGet, "/rooms/"+abandoned.Id, "", nil); code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", code)
+	}
+	// the result stays available for the retention
+	if code := do(t, e, http.MethodGet, "/rooms/"+finished.Id+"/result", "", nil); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	now = now.Add(time.Hour)
+	expired = s.Rooms.Expire(now, time.Minute, time.Hour)
+	if len(expired) != 1 || expired[0].Id != finished.Id {
+		t.Fatalf("expected the finished room to expire, got %v", expired)
+	}
+	if rooms := s.Rooms.List(); len(rooms) != 2 || rooms[0] != room || rooms[1].Id != played.Id {
+		t.Fatalf("unexpected rooms left %v", rooms)
+	}
+}
+
+func TestResultOfFinishedGame(t *testing.T) {
+	e, _, room := testServer(t)
+
+	if code := do(t, e, http.MethodGet, "/rooms/"+room.Id+"/result", "", nil); code != http.StatusConflict {
+		t.Fatalf("expected 409 before the end of the game, got %d", code)
+	}
+	if code := do(t, e, http.MethodGet, "/board/seed", "", nil); code != http.StatusConflict {
+		t.Fatalf("expected 409 before the end of the game, got %d", code)
+	}
+
+	finish(room.Board)
+	var result GameResult
+	if code := do(t, e, http.MethodGet, "/rooms/"+room.Id+"/result", "", &result); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if len(result.Proofs) != game.PairCount || !result.Seed.Server.Equal(starknet.FeltFromInt(1)) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	seed, _ := json.Marshal(result.Seed)
+	var replay ReplayResponse
+	if code := do(t, e, http.MethodPost, "/replay", string(seed), &replay); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if !replay.Commitment.Equal(room.Board.Commitment) || replay.Layout[0][0] != result.Layout[0][0] {
+		t.Fatal("replay does not match the game")
+	}
+}
+
+func TestPlayerProfile(t *testing.T) {
+	e, _, room := testServer(t)
+	account := starknet.FeltFromInt(0xacc)
+	room.Board.RecordMove(game.SignedMove{Account: account, X: 1, Y: 1})
+	room.Board.RecordMove(game.SignedMove{Account: account, X: 1, Y: 2})
+
+	var profile PlayerProfile
+	if code := do(t, e, http.MethodGet, "/players/"+account.String(), "", &profile); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if profile.Moves != 2 || len(profile.Rooms) != 1 || profile.Rooms[0] != room.Id {
+		t.Fatalf("unexpected profile %+v", profile)
+	}
+	if code := do(t, e, http.MethodGet, "/players/0xbee", "", nil); code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", code)
+	}
+	if code := do(t, e, http.MethodGet, "/players/nope", "", nil); code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", code)
+	}
+}
+
+func TestCollection(t *testing.T) {
+	e, _, _ := testServer(t)
+	var res CollectionResponse
+	if code := do(t, e, http.MethodGet, "/collection", "", &res); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if res.Config.Id != data.DefaultCollectionId || len(res.Tokens) != 40 || res.Tokens[0].TokenId != 1 {
+		t.Fatalf("unexpected collection %+v", res.Config)
+	}
+}
+
+func TestOpenApiCoversRoutes(t *testing.T) {
+	e, s, _ := testServer(t)
+	var spec struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if code := do(t, e, http.MethodGet, "/openapi.json", "", &spec); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	for _, r := range s.routes() {
+		path, _ := openApiPath(r.Path)
+		if _, ok := spec.Paths[path][strings.ToLower(r.Method)]; !ok {
+			t.Errorf("%s %s missing from the spec", r.Method, path)
+		}
+	}
+	for _, name := range []string{"GameResult", "SignedMove", "Session", "MatchProof", "Attributes"} {
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s missing", name)
+		}
+	}
+}
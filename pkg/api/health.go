@@ -0,0 +1,155 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/labstack/echo/v4"
+
+	"github.com/MartianGreed/memo-backend/pkg/data"
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+)
+
+type (
+	EndpointStatus struct {
+		Url     string `json:"url"`
+		Healthy bool   `json:"healthy"`
+	}
+	RpcStatus struct {
+		Network   starknet.StarknetNetwork `json:"network"`
+		ChainId   *felt.Felt               `json:"chain_id"`
+		Reachable bool                     `json:"reachable"`
+		Endpoints []EndpointStatus         `json:"endpoints"`
+	}
+	CollectionStatus struct {
+		Id       string        `json:"id"`
+		Loaded   int           `json:"loaded"`
+		Failed   []int         `json:"failed"`
+		Complete bool          `json:"complete"`
+		Duration time.Duration `json:"duration"`
+	}
+	HealthStatus struct {
+		Ready       bool              `json:"ready"`
+		Draining    bool              `json:"draining"`
+		Uptime      time.Duration     `json:"uptime"`
+		Collection  *CollectionStatus `json:"collection,omitempty"`
+		Rpc         *RpcStatus        `json:"rpc,omitempty"`
+		Rooms       int               `json:"rooms"`
+		Connections int               `json:"connections"`
+	}
+)
+
+// Health backs /healthz and /readyz. The server listens while the collection
+// is loading, it only becomes ready once the default board is created.
+type Health struct {
+	Rooms *Rooms
+
+	started    time.Time
+	ready      atomic.Bool
+	draining   atomic.Bool
+	mu         sync.RWMutex
+	rpc        *starknet.JsonRpcStarknetClient
+	collection *CollectionStatus
+}
+
+func NewHealth(rooms *Rooms) *Health {
+	return &Health{Rooms: rooms, started: time.Now()}
+}
+
+func (h *Health) SetRpc(rpc *starknet.JsonRpcStarknetClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rpc = rpc
+}
+
+func (h *Health) SetCollection(id string, report data.LoadReport) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.collection = &CollectionStatus{
+		Id:       id,
+		Loaded:   len(report.Loaded),
+		Failed:   report.FailedIds(),
+		Complete: report.Complete(),
+		Duration: report.Duration,
+	}
+}
+
+// MarkReady is called once everything the routes depend on is set
+func (h *Health) MarkReady() {
+	h.ready.Store(true)
+}
+
+// MarkDraining is called on shutdown, the server is not ready anymore so the
+// load balancer stops sending players while the rooms are drained
+func (h *Health) MarkDraining() {
+	h.draining.Store(true)
+}
+
+func (h *Health) Ready() bool {
+	return h.ready.Load() && !h.draining.Load() && h.Rooms.Default() != nil
+}
+
+func (h *Health) Status() HealthStatus {
+	status := HealthStatus{Ready: h.Ready(), Draining: h.draining.Load(), Uptime: time.Since(h.started)}
+
+	h.mu.RLock()
+	status.Collection = h.collection
+	rpc := h.rpc
+	h.mu.RUnlock()
+	if rpc != nil {
+		chainId, _ := starknet.ChainId(rpc.Network)
+		status.Rpc = &RpcStatus{Network: rpc.Network, ChainId: chainId}
+		for _, e := range rpc.Endpoints {
+			status.Rpc.Endpoints = append(status.Rpc.Endpoints, EndpointStatus{Url: e.Url, Healthy: e.Healthy()})
+			status.Rpc.Reachable = status.Rpc.Reachable || e.Healthy()
+		}
+	}
+
+	for _, room := range h.Rooms.List() {
+		status.Rooms++
+		room.Pool.RLock()
+		status.Connections += len(room.Pool.Connections)
+		room.Pool.RUnlock()
+	}
+	return status
+}
+
+// Register adds the probes, they are answered even before the server is ready
+func (h *Health) Register(e *echo.Echo) {
+	e.GET("/healthz", h.healthz)
+	e.GET("/readyz", h.readyz)
+}
+
+// liveness, the process is up
+func (h *Health) healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.Status())
+}
+
+func (h *Health) readyz(c echo.Context) error {
+	status := h.Status()
+	if !status.Ready {
+		return c.JSON(http.StatusServiceUnavailable, status)
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// RequireReady answers 503 to every request but the probes and metrics until
+// the server is ready and once it is shutting down
+func (h *Health) RequireReady(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		switch c.Path() {
+		case "/healthz", "/readyz", "/metrics":
+			return next(c)
+		}
+		if h.draining.Load() {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "server is shutting down")
+		}
+		if !h.Ready() {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "server is starting")
+		}
+		return next(c)
+	}
+}
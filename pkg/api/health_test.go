@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/MartianGreed/memo-backend/pkg/data"
+	"github.com/MartianGreed/memo-backend/pkg/game"
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+)
+
+func TestReadinessFollowsStartup(t *testing.T) {
+	rooms := NewRooms()
+	health := NewHealth(rooms)
+	s := NewServer(rooms, nil, nil)
+	e := echo.New()
+	health.Register(e)
+	e.Use(health.RequireReady)
+	s.Register(e)
+
+	var status HealthStatus
+	if code := do(t, e, http.MethodGet, "/healthz", "", &status); code != http.StatusOK || status.Ready {
+		t.Fatalf("expected a live but not ready server, got %d %+v", code, status)
+	}
+	if code := do(t, e, http.MethodGet, "/readyz", "", nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", code)
+	}
+	if code := do(t, e, http.MethodGet, "/rooms", "", nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected routes to be gated, got %d", code)
+	}
+
+	// same order as main: collection, board, then ready
+	_, loaded, room := testServer(t)
+	s.Collection, s.ChainId = loaded.Collection, loaded.ChainId
+	health.SetCollection(data.DefaultCollectionId, data.LoadReport{Loaded: []int{1, 2}, Failed: map[int]error{3: nil}, Duration: time.Second})
+	health.SetRpc(starknet.NewJsonRpcStarknetClientWithProviders(starknet.Mainnet, starknet.Provider{Url: "http://127.0.0.1:1"}))
+	health.MarkReady()
+	if code := do(t, e, http.MethodGet, "/readyz", "", nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without a board, got %d", code)
+	}
+	rooms.Add(room)
+
+	if code := do(t, e, http.MethodGet, "/readyz", "", &status); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if !status.Ready || status.Rooms != 1 || status.Collection == nil || status.Collection.Complete || status.Collection.Failed[0] != 3 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if chainId, _ := starknet.ChainId(starknet.Mainnet); status.Rpc == nil || !status.Rpc.ChainId.Equal(chainId) || len(status.Rpc.Endpoints) != 1 {
+		t.Fatalf("unexpected rpc status %+v", status.Rpc)
+	}
+	if code := do(t, e, http.MethodGet, "/rooms", "", nil); code != http.StatusOK {
+		t.Fatalf("expected 200 once ready, got %d", code)
+	}
+}
+
+func TestDrainingRefusesPlayers(t *testing.T) {
+	e, s, room := testServer(t)
+	health := NewHealth(s.Rooms)
+	health.Register(e)
+	e.Use(health.RequireReady)
+	health.MarkReady()
+	if code := do(t, e, http.MethodGet, "/readyz", "", nil); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	health.MarkDraining()
+	if code := do(t, e, http.MethodGet, "/readyz", "", nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while draining, got %d", code)
+	}
+	var status HealthStatus
+	if code := do(t, e, http.MethodGet, "/healthz", "", &status); code != http.StatusOK || !status.Draining || status.Ready {
+		t.Fatalf("expected a live draining server, got %d %+v", code, status)
+	}
+	if code := do(t, e, http.MethodGet, "/rooms", "", nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected routes to be gated while draining, got %d", code)
+	}
+	if err := health.Rooms.Shutdown(context.Background(), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if room.Pool.Join(nil, &game.ConnectionBuf{}, nil) {
+		t.Fatal("expected the rooms to refuse connections")
+	}
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/labstack/echo/v4"
+
+	"github.com/MartianGreed/memo-backend/pkg/game"
+)
+
+// route describes an endpoint both for echo and for the OpenAPI spec
+type route struct {
+	Method  string
+	Path    string
+	Summary string
+	Handler echo.HandlerFunc
+	// zero values of the request and response bodies, nil for none
+	Request    any
+	Response   any
+	Status     int
+	Deprecated bool
+}
+
+func (s *Server) routes() []route {
+	return []route{
+		{Method: http.MethodGet, Path: "/rooms", Summary: "List rooms", Handler: s.listRooms, Response: []RoomSummary{}, Status: http.StatusOK},
+		{Method: http.MethodPost, Path: "/rooms", Summary: "Create a room with a new board", Handler: s.createRoom, Response: RoomSummary{}, Status: http.StatusCreated},
+		{Method: http.MethodGet, Path: "/rooms/:id", Summary: "Public state of the board of a room", Handler: s.getBoard, Response: BoardState{}, Status: http.StatusOK},
+		{Method: http.MethodGet, Path: "/rooms/:id/players", Summary: "Players connected to a room", Handler: s.listPlayers, Response: []RoomPlayer{}, Status: http.StatusOK},
+		{Method: http.MethodGet, Path: "/rooms/:id/moves", Summary: "Signed moves played in a room", Handler: s.listMoves, Response: []game.SignedMove{}, Status: http.StatusOK},
+		{Method: http.MethodGet, Path: "/rooms/:id/seed", Summary: "Seed of a finished game", Handler: s.revealSeed, Response: game.Seed{}, Status: http.StatusOK},
+		{Method: http.MethodGet, Path: "/rooms/:id/result", Summary: "Result and match proofs of a finished game", Handler: s.getResult, Response: GameResult{}, Status: http.StatusOK},
+		{Method: http.MethodGet, Path: "/players/:account", Summary: "Profile of a player", Handler: s.getPlayer, Response: PlayerProfile{}, Status: http.StatusOK},
+		{Method: http.MethodPost, Path: "/replay", Summary: "Regenerate a board from its seed", Handler: s.replayBoard, Request: game.Seed{}, Response: ReplayResponse{}, Status: http.StatusOK},
+		{Method: http.MethodGet, Path: "/collection", Summary: "Loaded collection metadata", Handler: s.getCollection, Response: CollectionResponse{}, Status: http.StatusOK},
+		{Method: http.MethodGet, Path: "/openapi.json", Summary: "This specification", Handler: s.getOpenApi, Status: http.StatusOK},
+		// paths of the single board server, they act on the default room
+		{Method: http.MethodGet, Path: "/board/seed", Summary: "Seed of the default room", Handler: s.revealSeed, Response: game.Seed{}, Status: http.StatusOK, Deprecated: true},
+		{Method: http.MethodGet, Path: "/board/moves", Summary: "Signed moves of the default room", Handler: s.listMoves, Response: []game.SignedMove{}, Status: http.StatusOK, Deprecated: true},
+		{Method: http.MethodPost, Path: "/board/replay", Summary: "Regenerate a board from its seed", Handler: s.replayBoard, Request: game.Seed{}, Response: ReplayResponse{}, Status: http.StatusOK, Deprecated: true},
+	}
+}
+
+// OpenApi generates the OpenAPI 3 document of the routes, schemas are derived
+// from the json encoding of the request and response types.
+func (s *Server) OpenApi() map[string]any {
+	g := &schemaGenerator{schemas: map[string]any{}}
+	paths := map[string]map[string]any{}
+	for _, r := range s.routes() {
+		path, params := openApiPath(r.Path)
+		op := map[string]any{
+			"summary":     r.Summary,
+			"operationId": operationId(r.Method, r.Path),
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if r.Deprecated {
+			op["deprecated"] = true
+		}
+		if r.Request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(r.Request))}},
+			}
+		}
+		response := map[string]any{"description": http.StatusText(r.Status)}
+		if r.Response != nil {
+			response["content"] = map[string]any{"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(r.Response))}}
+		}
+		op["responses"] = map[string]any{strconv.Itoa(r.Status): response}
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(r.Method)] = op
+	}
+	return map[string]any{
+		"openapi":    "3.0.3",
+		"info":       map[string]any{"title": "memo backend", "version": "1"},
+		"paths":      paths,
+		"components": map[string]any{"schemas": g.schemas},
+	}
+}
+
+// operationId derives a camel case id such as getRoomsIdPlayers from a route
+func operationId(method string, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == ':' || r == '.' }) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// openApiPath turns echo :params into {params}
+func openApiPath(path string) (string, []map[string]any) {
+	var params []map[string]any
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") {
+			name := part[1:]
+			parts[i] = "{" + name + "}"
+			params = append(params, map[string]any{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string"},
+			})
+		}
+	}
+	return strings.Join(parts, "/"), params
+}
+
+type schemaGenerator struct {
+	schemas map[string]any
+}
+
+var (
+	feltType = reflect.TypeOf(felt.Felt{})
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case feltType:
+		return map[string]any{"type": "string", "pattern": "^0x[0-9a-fA-F]+$"}
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		return g.object(t)
+	}
+	// interfaces accept any value
+	return map[string]any{}
+}
+
+// object registers struct types as components and references them
+func (g *schemaGenerator) object(t reflect.Type) map[string]any {
+	name := t.Name()
+	ref := map[string]any{"$ref": "#/components/schemas/" + name}
+	if _, ok := g.schemas[name]; ok {
+		return ref
+	}
+	// placeholder so recursive types terminate
+	g.schemas[name] = map[string]any{}
+
+	properties := map[string]any{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		field, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if field == "-" {
+			continue
+		}
+		if field == "" {
+			field = f.Name
+		}
+		properties[field] = g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, field)
+		}
+	}
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	g.schemas[name] = schema
+	return ref
+}
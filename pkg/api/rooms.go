@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/MartianGreed/memo-backend/pkg/game"
+	"github.com/MartianGreed/memo-backend/pkg/metrics"
+)
+
+// Room is a game being played, its id is the board commitment
+type Room struct {
+	Id        string
+	CreatedAt time.Time
+	Board     *game.Board
+	Pool      *game.ConnectionPool
+
+	// guarded by Rooms.mu, last time Expire saw players and first time it saw the game finished
+	seenAt     time.Time
+	finishedAt time.Time
+}
+
+func NewRoom(board *game.Board) *Room {
+	now := time.Now()
+	return &Room{
+		Id:        board.Commitment.String(),
+		CreatedAt: now,
+		Board:     board,
+		Pool:      game.NewConnectionPool(),
+		seenAt:    now,
+	}
+}
+
+// Rooms keeps every room in creation order, the first one is the default room
+type Rooms struct {
+	mu    sync.RWMutex
+	rooms map[string]*Room
+	order []string
+}
+
+func NewRooms() *Rooms {
+	return &Rooms{rooms: map[string]*Room{}}
+}
+
+func (r *Rooms) Add(room *Room) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.rooms[room.Id]; !ok {
+		r.order = append(r.order, room.Id)
+	}
+	r.rooms[room.Id] = room
+}
+
+// TryAdd adds room unless limit rooms are still being played, finished rooms
+// do not count. A limit of zero disables it.
+func (r *Rooms) TryAdd(room *Room, limit int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if limit > 0 {
+		active := 0
+		for _, other := range r.rooms {
+			if !other.Board.Finished() {
+				active++
+			}
+		}
+		if active >= limit {
+			return false
+		}
+	}
+	if _, ok := r.rooms[room.Id]; !ok {
+		r.order = append(r.order, room.Id)
+	}
+	r.rooms[room.Id] = room
+	return true
+}
+
+func (r *Rooms) Get(id string) (*Room, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	room, ok := r.rooms[id]
+	return room, ok
+}
+
+// Default returns the first room, nil when there is none yet
+func (r *Rooms) Default() *Room {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.order) == 0 {
+		return nil
+	}
+	return r.rooms[r.order[0]]
+}
+
+func (r *Rooms) List() []*Room {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rooms := make([]*Room, len(r.order))
+	for i, id := range r.order {
+		rooms[i] = r.rooms[id]
+	}
+	return rooms
+}
+
+// Lookup returns the room with id, or the default room for an empty id
+func (r *Rooms) Lookup(id string) (*Room, bool) {
+	if id == "" {
+		room := r.Default()
+		return room, room != nil
+	}
+	return r.Get(id)
+}
+
+// Expire removes the unfinished rooms nobody played in for idle, and the
+// finished ones once their result was available for retention. The default
+// room and rooms with players connected are kept. It returns the removed rooms.
+func (r *Rooms) Expire(now time.Time, idle time.Duration, retention time.Duration) []*Room {
+	expired := r.expire(now, idle, retention)
+	for _, room := range expired {
+		// finished games were observed when their last pair was matched
+		if !room.Board.Finished() {
+			metrics.MatchesPerGame.Observe(float64(room.Board.Matches()))
+		}
+	}
+	return expired
+}
+
+func (r *Rooms) expire(now time.Time, idle time.Duration, retention time.Duration) []*Room {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var expired []*Room
+	order := r.order[:0]
+	for i, id := range r.order {
+		room := r.rooms[id]
+		room.Pool.RLock()
+		connected := len(room.Pool.Connections) > 0
+		room.Pool.RUnlock()
+		if connected {
+			room.seenAt = now
+		}
+		finished := room.Board.Finished()
+		if finished && room.finishedAt.IsZero() {
+			room.finishedAt = now
+		}
+
+		keep := i == 0 || connected
+		if finished {
+			keep = keep || now.Sub(room.finishedAt) < retention
+		} else {
+			keep = keep || now.Sub(room.seenAt) < idle
+		}
+		if keep {
+			order = append(order, id)
+			continue
+		}
+		delete(r.rooms, id)
+		expired = append(expired, room)
+	}
+	r.order = order
+	return expired
+}
+
+// StartExpiry expires rooms every interval until ctx is done
+func (r *Rooms) StartExpiry(ctx context.Context, interval time.Duration, idle time.Duration, retention time.Duration) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				for _, room := range r.Expire(now, idle, retention) {
+					slog.Info("room expired", "id", room.Id, "finished", room.Board.Finished())
+				}
+			}
+		}
+	}()
+}
+
+// Shutdown drains every room at once, see game.ConnectionPool.Shutdown
+func (r *Rooms) Shutdown(ctx context.Context, reconnectAfter time.Duration) error {
+	rooms := r.List()
+	errs := make([]error, len(rooms))
+	var wg sync.WaitGroup
+	for i, room := range rooms {
+		wg.Add(1)
+		go func(i int, room *Room) {
+			defer wg.Done()
+			errs[i] = room.Pool.Shutdown(ctx, game.NewShutdownMessage(reconnectAfter))
+			// finished games were observed when their last pair was matched
+			if !room.Board.Finished() {
+				metrics.MatchesPerGame.Observe(float64(room.Board.Matches()))
+			}
+		}(i, room)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,203 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+
+	"github.com/MartianGreed/memo-backend/internal/fsutil"
+	"github.com/MartianGreed/memo-backend/pkg/metrics"
+)
+
+var (
+	ErrMiss    = errors.New("cache miss")
+	ErrCorrupt = errors.New("corrupt cache entry")
+)
+
+// Key identifies a token across networks and contracts
+type Key struct {
+	Network  string
+	Contract string
+	TokenId  int
+}
+
+func (k Key) String() string {
+	return fmt.Sprintf("%s/%s/%d", k.Network, normalizeContract(k.Contract), k.TokenId)
+}
+
+func (k Key) dir(root string) string {
+	return filepath.Join(root, k.Network, normalizeContract(k.Contract))
+}
+
+// contract addresses are compared by value so 0x0539f… and 0x539f… share entries
+func normalizeContract(contract string) string {
+	f, err := new(felt.Felt).SetString(contract)
+	if err != nil {
+		return strings.ToLower(contract)
+	}
+	return f.String()
+}
+
+// Entry is the metadata stored next to every cached payload
+type Entry struct {
+	Key       string    `json:"key"`
+	Checksum  string    `json:"checksum"`
+	Size      int       `json:"size"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Data      []byte    `json:"-"`
+}
+
+type Cache struct {
+	Dir string
+	// Entries older than TTL are revalidated, zero means they never expire
+	TTL time.Duration
+	now func() time.Time
+}
+
+func New(dir string, ttl time.Duration) *Cache {
+	return &Cache{Dir: dir, TTL: ttl, now: time.Now}
+}
+
+func (c *Cache) Fresh(e *Entry) bool {
+	return c.TTL == 0 || c.now().Sub(e.FetchedAt) < c.TTL
+}
+
+// Get returns the cached entry for key, or ErrMiss. Entries whose payload does
+// not match the stored checksum are removed and reported as ErrCorrupt.
+func (c *Cache) Get(key Key) (*Entry, error) {
+	dir := key.dir(c.Dir)
+	metaFile := filepath.Join(dir, fmt.Sprintf("%d.meta.json", key.TokenId))
+	dataFile := filepath.Join(dir, fmt.Sprintf("%d.json", key.TokenId))
+
+	meta, err := os.ReadFile(metaFile)
+	if os.IsNotExist(err) {
+		return nil, ErrMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(meta, &entry); err != nil {
+		c.remove(metaFile, dataFile)
+		return nil, errors.Mark(errors.Wrapf(err, "%s", key), ErrCorrupt)
+	}
+
+	entry.Data, err = os.ReadFile(dataFile)
+	if os.IsNotExist(err) {
+		c.remove(metaFile)
+		return nil, ErrMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	if checksum(entry.Data) != entry.Checksum {
+		c.remove(metaFile, dataFile)
+		return nil, errors.Wrapf(ErrCorrupt, "%s: checksum mismatch", key)
+	}
+	return &entry, nil
+}
+
+// Put atomically stores data for key. The payload is written before its
+// metadata so a reader never sees a checksum for a partial file.
+func (c *Cache) Put(key Key, data []byte) (*Entry, error) {
+	dir := key.dir(c.Dir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	entry := &Entry{
+		Key:       key.String(),
+		Checksum:  checksum(data),
+		Size:      len(data),
+		FetchedAt: c.now().UTC(),
+		Data:      data,
+	}
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	if err := fsutil.WriteAtomic(filepath.Join(dir, fmt.Sprintf("%d.json", key.TokenId)), data); err != nil {
+		return nil, err
+	}
+	if err := fsutil.WriteAtomic(filepath.Join(dir, fmt.Sprintf("%d.meta.json", key.TokenId)), meta); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// GetOrFetch serves fresh entries from disk and revalidates stale ones with
+// fetch. When fetch fails a stale entry is still served.
+func (c *Cache) GetOrFetch(ctx context.Context, key Key, fetch func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	entry, err := c.Get(key)
+	if err != nil && !errors.Is(err, ErrMiss) {
+		slog.Warn("ignoring cache entry", "key", key.String(), "error", err)
+	}
+	if entry != nil && c.Fresh(entry) {
+		metrics.CacheRequests.WithLabelValues("hit").Inc()
+		return entry.Data, nil
+	}
+
+	data, err := fetch(ctx)
+	if err != nil {
+		if entry != nil {
+			metrics.CacheRequests.WithLabelValues("stale").Inc()
+			slog.Warn("serving stale cache entry", "key", key.String(), "fetched_at", entry.FetchedAt, "error", err)
+			return entry.Data, nil
+		}
+		metrics.CacheRequests.WithLabelValues("miss").Inc()
+		return nil, err
+	}
+	metrics.CacheRequests.WithLabelValues("miss").Inc()
+	if _, err := c.Put(key, data); err != nil {
+		slog.Warn("failed to write cache entry", "key", key.String(), "error", err)
+	}
+	return data, nil
+}
+
+// PutImage renders a decoded image next to the token metadata and returns its path
+func (c *Cache) PutImage(key Key, mediaType string, payload []byte) (string, error) {
+	dir := key.dir(c.Dir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%d%s", key.TokenId, imageExtension(mediaType)))
+	return path, fsutil.WriteAtomic(path, payload)
+}
+
+func imageExtension(mediaType string) string {
+	switch mediaType {
+	case "image/svg+xml":
+		return ".svg"
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	}
+	return ".bin"
+}
+
+func (c *Cache) remove(files ...string) {
+	for _, f := range files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			slog.Warn("failed to remove cache file", "file", f, "error", err)
+		}
+	}
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
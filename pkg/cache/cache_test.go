@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/MartianGreed/memo-backend/pkg/metrics"
+)
+
+var key = Key{Network: "mainnet", Contract: "0x00539f522b29ae9251dbf7443c7a950cf260372e69efab3710a11bf17a9599f1", TokenId: 12}
+
+func TestPutGet(t *testing.T) {
+	c := New(t.TempDir(), time.Hour)
+	if _, err := c.Get(key); !errors.Is(err, ErrMiss) {
+		t.Fatalf("expected miss, got %v", err)
+	}
+	if _, err := c.Put(key, []byte("uri")); err != nil {
+		t.Fatal(err)
+	}
+
+	// keys are normalized on the contract address
+	entry, err := c.Get(Key{Network: "mainnet", Contract: "0x539f522b29ae9251dbf7443c7a950cf260372e69efab3710a11bf17a9599f1", TokenId: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(entry.Data) != "uri" || !c.Fresh(entry) {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+	if _, err := c.Get(Key{Network: "sepolia", Contract: key.Contract, TokenId: 12}); !errors.Is(err, ErrMiss) {
+		t.Fatalf("networks must not share entries, got %v", err)
+	}
+}
+
+func TestGetDetectsPartialWrites(t *testing.T) {
+	c := New(t.TempDir(), time.Hour)
+	if _, err := c.Put(key, []byte("complete payload")); err != nil {
+		t.Fatal(err)
+	}
+	dataFile := filepath.Join(key.dir(c.Dir), "12.json")
+	if err := os.WriteFile(dataFile, []byte("compl"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(key); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected corrupt entry, got %v", err)
+	}
+	if _, err := c.Get(key); !errors.Is(err, ErrMiss) {
+		t.Fatalf("corrupt entry should have been removed, got %v", err)
+	}
+}
+
+func TestGetOrFetchRevalidates(t *testing.T) {
+	now := time.Now()
+	c := New(t.TempDir(), time.Hour)
+	c.now = func() time.Time { return now }
+
+	calls := 0
+	fetch := func(context.Context) ([]byte, error) {
+		calls++
+		return []byte("v" + string(rune('0'+calls))), nil
+	}
+	fail := func(context.Context) ([]byte, error) { return nil, errors.New("rpc down") }
+	requests := func(result string) float64 {
+		return testutil.ToFloat64(metrics.CacheRequests.WithLabelValues(result))
+	}
+	hits, stale, misses := requests("hit"), requests("stale"), requests("miss")
+
+	data, err := c.GetOrFetch(context.Background(), key, fetch)
+	if err != nil || string(data) != "v1" {
+		t.Fatalf("unexpected %s, %v", data, err)
+	}
+	data, _ = c.GetOrFetch(context.Background(), key, fetch)
+	if string(data) != "v1" || calls != 1 {
+		t.Fatalf("fresh entry should be served from cache, got %s after %d calls", data, calls)
+	}
+
+	now = now.Add(2 * time.Hour)
+	data, err = c.GetOrFetch(context.Background(), key, fail)
+	if err != nil || string(data) != "v1" {
+		t.Fatalf("stale entry should be served when fetch fails, got %s, %v", data, err)
+	}
+	data, _ = c.GetOrFetch(context.Background(), key, fetch)
+	if string(data) != "v2" {
+		t.Fatalf("stale entry should be revalidated, got %s", data)
+	}
+	if requests("hit") != hits+1 || requests("stale") != stale+1 || requests("miss") != misses+2 {
+		t.Fatalf("unexpected cache metrics %v %v %v", requests("hit")-hits, requests("stale")-stale, requests("miss")-misses)
+	}
+}
+
+func TestPutImage(t *testing.T) {
+	c := New(t.TempDir(), 0)
+	path, err := c.PutImage(key, "image/svg+xml", []byte("<svg></svg>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(path) != "12.svg" {
+		t.Fatalf("unexpected path %s", path)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil || string(b) != "<svg></svg>" {
+		t.Fatalf("unexpected image %s, %v", b, err)
+	}
+}
@@ -1,147 +1,125 @@
 package data
 
 import (
-	"encoding/base64"
-	"encoding/json"
-	"fmt"
-	"io"
+	"context"
 	"log/slog"
-	"math/rand"
-	"os"
 	"slices"
-	"strings"
 	"sync"
 
+	"github.com/cockroachdb/errors"
+
+	"github.com/MartianGreed/memo-backend/pkg/cache"
 	"github.com/MartianGreed/memo-backend/pkg/starknet"
 )
 
-const MaxTokenId = 50
-
 type Collection struct {
-	inner map[int]Attributes
+	config CollectionConfig
+	inner  map[int]Attributes
 	sync.Mutex
 }
 
-func (c *Collection) GetPairs() []Attributes {
-	v := getTokenIds()
-	pairs := make([]int, 30)
-	for i := 1; i < 31; i++ {
-		r := rand.Intn(31-1) + 1
-		if slices.Contains(pairs, v[r]) {
-			i--
-			continue
-		}
-		pairs[i-1] = v[r]
-	}
-	var attributes []Attributes
-	for _, i := range pairs {
-		attributes = append(attributes, c.inner[i])
+func NewCollection(config CollectionConfig, attributes ...Attributes) *Collection {
+	c := &Collection{config: config, inner: make(map[int]Attributes)}
+	for _, attr := range attributes {
+		c.inner[attr.TokenId] = attr
 	}
-	return attributes
+	return c
 }
 
-type Attributes struct {
-	Name        string              `json:"name"`
-	Description string              `json:"description"`
-	Image       string              `json:"image"`
-	Attributes  []map[string]string `json:"attributes"`
-	TokenId     int                 `json:"token_id"`
+func (c *Collection) Id() string {
+	return c.config.Id
 }
 
-func LoadCollection() *Collection {
-	slog.Info("load collection")
-	collection := &Collection{inner: make(map[int]Attributes)}
-	rpc := starknet.MainnetJsonRpcStarknetClient()
-	uriCh := make(chan string)
-	for i := 1; i <= MaxTokenId; i++ {
-		go fetchBloblertTokenUri(rpc, i, uriCh)
-		uri := <-uriCh
-		appendToCollection(collection, i, uri)
-	}
-
-	slog.Info("collection loaded")
-	return collection
+func (c *Collection) Config() CollectionConfig {
+	return c.config
 }
 
-func fetchBloblertTokenUri(rpc starknet.StarknetRpcClient, i int, uriCh chan string) {
-	// check if file i.json exists in filesystem
-	fName := fmt.Sprintf("data/%d.json", i)
-	if fileExists(fName) {
-		uriCh <- readFromFile(fName)
-		return
+// TokenIds returns the loaded token ids in ascending order
+func (c *Collection) TokenIds() []int {
+	c.Lock()
+	defer c.Unlock()
+	ids := make([]int, 0, len(c.inner))
+	for id := range c.inner {
+		ids = append(ids, id)
 	}
+	slices.Sort(ids)
+	return ids
+}
 
-	uri, err := starknet.GetTokenUri(rpc, "0x00539f522b29ae9251dbf7443c7a950cf260372e69efab3710a11bf17a9599f1", i)
-	if err != nil {
-		slog.Error(fmt.Sprintf("failed to fetch blobert id : %d", i), "error", err)
-	}
+func (c *Collection) Get(tokenId int) Attributes {
+	c.Lock()
+	defer c.Unlock()
+	return c.inner[tokenId]
+}
 
-	go writeToFile(fName, uri)
+type Attributes struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Image       string           `json:"image"`
+	Attributes  []map[string]any `json:"attributes"`
+	TokenId     int              `json:"token_id"`
+}
 
-	uriCh <- uri
+func cacheKey(config CollectionConfig, i int) cache.Key {
+	return cache.Key{Network: string(config.Network), Contract: config.ContractAddress, TokenId: i}
 }
 
-func fileExists(fName string) bool {
-	_, err := os.Stat(fName)
-	return !os.IsNotExist(err)
+type tokenUriResult struct {
+	uri string
+	err error
 }
 
-func readFromFile(fName string) string {
-	f, err := os.Open(fName)
-	if err != nil {
-		slog.Error("failed to open file", "error", err)
+// fetchTokenUri reads the token uri from the cache, the batch prefetch or fetches it onchain
+func fetchTokenUri(ctx context.Context, rpc starknet.StarknetRpcClient, c *cache.Cache, config CollectionConfig, i int, prefetched map[int]tokenUriResult) (string, error) {
+	fetch := func(ctx context.Context) (string, error) {
+		if res, ok := prefetched[i]; ok {
+			return res.uri, res.err
+		}
+		return starknet.GetTokenUri(ctx, rpc, config.ContractAddress, i)
 	}
-	defer f.Close()
-	b, err := io.ReadAll(f)
-	if err != nil {
-		slog.Error("failed to read file", "error", err)
+	if c == nil {
+		return fetch(ctx)
 	}
-	return string(b)
+	uri, err := c.GetOrFetch(ctx, cacheKey(config, i), func(ctx context.Context) ([]byte, error) {
+		uri, err := fetch(ctx)
+		return []byte(uri), err
+	})
+	return string(uri), err
 }
 
-func writeToFile(fName, data string) {
-	f, err := os.Create(fName)
-	if err != nil {
-		slog.Error("failed to create file", "error", err)
+// renderImage writes data uri images to the cache so they can be served as files
+func renderImage(c *cache.Cache, config CollectionConfig, attr Attributes) {
+	if kind, err := Kind(attr.Image); err != nil || kind != KindData {
+		return
 	}
-	defer f.Close()
-	_, err = f.WriteString(data)
+	mediaType, payload, err := DecodeDataUri(attr.Image)
 	if err != nil {
-		slog.Error("failed to write to file", "error", err)
+		slog.Warn("failed to decode image", "id", config.Id, "token", attr.TokenId, "error", err)
+		return
+	}
+	if _, err := c.PutImage(cacheKey(config, attr.TokenId), mediaType, payload); err != nil {
+		slog.Warn("failed to render image", "id", config.Id, "token", attr.TokenId, "error", err)
 	}
 }
 
-func appendToCollection(c *Collection, i int, uri string) {
-	uri = strings.Replace(uri, "data:application/json;base64,", "", 1)
-	uri = decodeBase64(uri)
-	attr := parseAttributesFromJsonStr(uri)
-	attr.TokenId = i
-
-	c.inner[i] = attr
+func (c *Collection) set(attr Attributes) {
+	c.Lock()
+	defer c.Unlock()
+	c.inner[attr.TokenId] = attr
 }
 
-func decodeBase64(s string) string {
-	decoded, err := base64.StdEncoding.DecodeString(s)
+func decodeTokenUri(ctx context.Context, resolver *Resolver, config CollectionConfig, i int, uri string) (Attributes, error) {
+	kind, err := Kind(uri)
 	if err != nil {
-		slog.Error("failed to decode base64", "error", err)
+		return Attributes{}, err
 	}
-	return string(decoded)
-}
-
-func parseAttributesFromJsonStr(s string) Attributes {
-	var attr Attributes
-	err := json.Unmarshal([]byte(s), &attr)
-	if err != nil {
-		slog.Error("failed to parse json string", "error", err)
+	if !config.UriDecoding.Accepts(kind) {
+		return Attributes{}, errors.Wrapf(ErrUnsupportedUri, "collection %s expects %s uris, got %s", config.Id, config.UriDecoding, kind)
 	}
-	return attr
-}
-
-func getTokenIds() []int {
-	var ids []int
-	for i := 1; i <= MaxTokenId; i++ {
-		ids = append(ids, i)
+	attr, err := resolver.Resolve(ctx, uri)
+	if err != nil {
+		return Attributes{}, err
 	}
-	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
-	return ids
+	attr.TokenId = i
+	return attr, nil
 }
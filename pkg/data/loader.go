@@ -0,0 +1,248 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/MartianGreed/memo-backend/pkg/cache"
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+)
+
+type LoadOptions struct {
+	// Number of tokens fetched concurrently
+	Workers int
+	// Attempts per token before giving up, transient rpc errors are retried
+	// by the client alone so they do not multiply with its own attempts
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Cache for token uris, nil disables caching
+	Cache *cache.Cache
+	// Write data uri images next to the cached metadata
+	RenderImages bool
+	// Resolver used to decode token uris, defaults to one fetching over http
+	Resolver *Resolver
+	// Token uris fetched per JSON-RPC batch when the client supports it, zero disables batching
+	BatchSize int
+}
+
+var DefaultLoadOptions = LoadOptions{
+	Workers:     8,
+	MaxAttempts: 4,
+	BaseBackoff: 250 * time.Millisecond,
+	MaxBackoff:  4 * time.Second,
+	BatchSize:   25,
+}
+
+// LoadReport tells which tokens made it into the collection
+type LoadReport struct {
+	Loaded   []int
+	Failed   map[int]error
+	Duration time.Duration
+}
+
+func (r LoadReport) Complete() bool {
+	return len(r.Failed) == 0
+}
+
+// FailedIds returns the ids of the tokens that could not be loaded in ascending order
+func (r LoadReport) FailedIds() []int {
+	var ids []int
+	for id := range r.Failed {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// LoadCollection fetches every token of the collection with a bounded pool of
+// workers. Tokens that still fail after retries are left out of the collection
+// and reported, the returned error is only set when ctx is done.
+func LoadCollection(ctx context.Context, rpc starknet.StarknetRpcClient, config CollectionConfig, opts LoadOptions) (*Collection, LoadReport, error) {
+	slog.Info("load collection", "id", config.Id)
+	start := time.Now()
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+
+	if opts.Resolver == nil {
+		opts.Resolver = NewResolver(NewHttpFetcher())
+	}
+
+	collection := NewCollection(config)
+	report := LoadReport{Failed: make(map[int]error)}
+	total := config.MaxTokenId - config.MinTokenId + 1
+
+	var prefetched map[int]tokenUriResult
+	if batcher, ok := rpc.(starknet.BatchStarknetRpcClient); ok && opts.BatchSize > 0 {
+		prefetched = prefetchTokenUris(ctx, batcher, config, opts)
+	}
+
+	jobs := make(chan int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				attr, err := loadToken(ctx, rpc, config, i, opts, prefetched)
+
+				mu.Lock()
+				if err != nil {
+					slog.Error(fmt.Sprintf("failed to load %s id : %d", config.Id, i), "error", err)
+					report.Failed[i] = err
+				} else {
+					collection.set(attr)
+					report.Loaded = append(report.Loaded, i)
+				}
+				done := len(report.Loaded) + len(report.Failed)
+				if done%10 == 0 || done == total {
+					slog.Info("collection load progress", "id", config.Id, "done", done, "total", total, "failed", len(report.Failed))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var err error
+	// ids never handed to a worker, merged once the workers are done with report
+	var unsent []int
+feed:
+	for i := config.MinTokenId; i <= config.MaxTokenId; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			err = ctx.Err()
+			for j := i; j <= config.MaxTokenId; j++ {
+				unsent = append(unsent, j)
+			}
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	for _, i := range unsent {
+		report.Failed[i] = err
+	}
+
+	slices.Sort(report.Loaded)
+	report.Duration = time.Since(start)
+	if err == nil {
+		err = ctx.Err()
+	}
+	slog.Info("collection loaded", "id", config.Id, "loaded", len(report.Loaded), "failed", len(report.Failed), "duration", report.Duration)
+	return collection, report, err
+}
+
+// prefetchTokenUris fetches the uris missing from the cache in a few batches.
+// Tokens that failed with a transient error are left to the workers.
+func prefetchTokenUris(ctx context.Context, rpc starknet.BatchStarknetRpcClient, config CollectionConfig, opts LoadOptions) map[int]tokenUriResult {
+	var missing []int
+	for i := config.MinTokenId; i <= config.MaxTokenId; i++ {
+		if opts.Cache != nil {
+			if entry, err := opts.Cache.Get(cacheKey(config, i)); err == nil && opts.Cache.Fresh(entry) {
+				continue
+			}
+		}
+		missing = append(missing, i)
+	}
+
+	prefetched := make(map[int]tokenUriResult, len(missing))
+	for start := 0; start < len(missing); start += opts.BatchSize {
+		chunk := missing[start:min(start+opts.BatchSize, len(missing))]
+		uris, failed, err := starknet.GetTokenUris(ctx, rpc, config.ContractAddress, chunk)
+		if err != nil {
+			slog.Warn("failed to batch fetch token uris", "id", config.Id, "from", chunk[0], "to", chunk[len(chunk)-1], "error", err)
+			continue
+		}
+		for i, uri := range uris {
+			prefetched[i] = tokenUriResult{uri: uri}
+		}
+		for i, err := range failed {
+			if !retryable(err) {
+				prefetched[i] = tokenUriResult{err: err}
+			}
+		}
+	}
+	slog.Info("prefetched token uris", "id", config.Id, "missing", len(missing), "fetched", len(prefetched))
+	return prefetched
+}
+
+func loadToken(ctx context.Context, rpc starknet.StarknetRpcClient, config CollectionConfig, i int, opts LoadOptions, prefetched map[int]tokenUriResult) (Attributes, error) {
+	var err error
+	for attempt := 0; attempt < opts.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, backoff(opts, attempt)); err != nil {
+				return Attributes{}, err
+			}
+		}
+
+		var uri string
+		uri, err = fetchTokenUri(ctx, rpc, opts.Cache, config, i, prefetched)
+		if err != nil {
+			// the client already backed off and failed over on transient errors
+			if !retryable(err) || starknet.IsRetryable(err) {
+				return Attributes{}, err
+			}
+			slog.Warn("failed to fetch token uri", "id", config.Id, "token", i, "attempt", attempt+1, "error", err)
+			continue
+		}
+
+		var attr Attributes
+		attr, err = decodeTokenUri(ctx, opts.Resolver, config, i, uri)
+		// only remote metadata fetches are worth retrying, decoding errors won't go away
+		if errors.Is(err, ErrFetchFailed) {
+			slog.Warn("failed to fetch token metadata", "id", config.Id, "token", i, "attempt", attempt+1, "error", err)
+			continue
+		}
+		if err == nil && opts.Cache != nil && opts.RenderImages {
+			renderImage(opts.Cache, config, attr)
+		}
+		return attr, err
+	}
+	return Attributes{}, err
+}
+
+// a missing contract, a revert or a malformed result won't change on retry
+func retryable(err error) bool {
+	return !errors.IsAny(err,
+		starknet.ErrContractNotFound,
+		starknet.ErrEntrypointNotFound,
+		starknet.ErrContractError,
+		starknet.ErrUnexpectedResponse,
+	)
+}
+
+// exponential backoff with full jitter
+func backoff(opts LoadOptions, attempt int) time.Duration {
+	d := opts.BaseBackoff << (attempt - 1)
+	if d <= 0 || d > opts.MaxBackoff {
+		d = opts.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
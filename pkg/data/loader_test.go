@@ -0,0 +1,162 @@
+package data
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+)
+
+// flakyRpc serves base64 json token uris, failing the first calls for some tokens
+type flakyRpc struct {
+	failures map[uint64]int
+	broken   map[uint64]bool
+	reverted map[uint64]bool
+	// rate limited as the client reports it once it gave up retrying
+	limited map[uint64]bool
+	calls   map[uint64]int
+	sync.Mutex
+}
+
+func (r *flakyRpc) Call(_ context.Context, address string, method string, params []felt.Felt) ([]felt.Felt, error) {
+	r.Lock()
+	defer r.Unlock()
+	id := params[0].Uint64()
+	if r.calls == nil {
+		r.calls = make(map[uint64]int)
+	}
+	r.calls[id]++
+	if r.reverted[id] {
+		return nil, errors.Mark(&starknet.RpcError{Code: 40, Message: "Contract error", Data: []byte(`{"revert_error":"ERC721: invalid token ID"}`)}, starknet.ErrContractError)
+	}
+	if r.limited[id] {
+		return nil, errors.Mark(&starknet.HttpError{StatusCode: 429}, starknet.ErrRateLimited)
+	}
+	if r.broken[id] {
+		return nil, errors.New("boom")
+	}
+	if r.failures[id] > 0 {
+		r.failures[id]--
+		return nil, errors.New("429 Too Many Requests")
+	}
+	uri := "data:application/json;base64," + base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(`{"name":"blobert #%d"}`, id)))
+	return starknet.EncodeByteArray(uri), nil
+}
+
+func TestLoadCollectionRetriesAndReportsFailures(t *testing.T) {
+	rpc := &flakyRpc{failures: map[uint64]int{2: 2}, broken: map[uint64]bool{3: true}, reverted: map[uint64]bool{4: true}}
+	config := CollectionConfig{Id: "test", ContractAddress: "0x1", Network: starknet.Mainnet, MinTokenId: 1, MaxTokenId: 5, UriDecoding: UriBase64Json}
+	opts := LoadOptions{Workers: 2, MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	collection, report, err := LoadCollection(context.Background(), rpc, config, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(report.Loaded, []int{1, 2, 5}) {
+		t.Fatalf("unexpected loaded tokens %v", report.Loaded)
+	}
+	if !slices.Equal(report.FailedIds(), []int{3, 4}) {
+		t.Fatalf("unexpected failed tokens %v", report.FailedIds())
+	}
+	if rpc.calls[3] != 3 || rpc.calls[4] != 1 {
+		t.Fatalf("reverted calls should not be retried, got %v", rpc.calls)
+	}
+	if !errors.Is(report.Failed[4], starknet.ErrContractError) {
+		t.Fatalf("expected contract error, got %v", report.Failed[4])
+	}
+	if !slices.Equal(collection.TokenIds(), report.Loaded) {
+		t.Fatalf("collection contains %v", collection.TokenIds())
+	}
+	if collection.Get(2).Name != "blobert #2" {
+		t.Fatalf("unexpected attributes %+v", collection.Get(2))
+	}
+}
+
+func TestLoadCollectionLeavesRpcRetriesToTheClient(t *testing.T) {
+	rpc := &flakyRpc{limited: map[uint64]bool{1: true}}
+	config := CollectionConfig{Id: "test", ContractAddress: "0x1", Network: starknet.Mainnet, MinTokenId: 1, MaxTokenId: 2, UriDecoding: UriBase64Json}
+	opts := LoadOptions{Workers: 1, MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	_, report, err := LoadCollection(context.Background(), rpc, config, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(report.Failed[1], starknet.ErrRateLimited) {
+		t.Fatalf("expected rate limited, got %v", report.Failed[1])
+	}
+	if rpc.calls[1] != 1 {
+		t.Fatalf("errors the client retried should not be retried again, got %d calls", rpc.calls[1])
+	}
+}
+
+func TestLoadCollectionHonoursDeadline(t *testing.T) {
+	rpc := &flakyRpc{broken: map[uint64]bool{1: true, 2: true}}
+	config := CollectionConfig{Id: "test", ContractAddress: "0x1", Network: starknet.Mainnet, MinTokenId: 1, MaxTokenId: 2, UriDecoding: UriBase64Json}
+	opts := LoadOptions{Workers: 1, MaxAttempts: 100, BaseBackoff: time.Second, MaxBackoff: time.Second}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, report, err := LoadCollection(ctx, rpc, config, opts)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if len(report.Failed) != 2 {
+		t.Fatalf("expected both tokens to fail, got %v", report.Failed)
+	}
+}
+
+// batchRpc answers batches from a flakyRpc and counts the round trips
+type batchRpc struct {
+	*flakyRpc
+	batches int
+}
+
+func (r *batchRpc) Batch(ctx context.Context, calls []*starknet.BatchCall) error {
+	r.batches++
+	for _, call := range calls {
+		b, _ := json.Marshal(call.Params)
+		var params struct {
+			Request struct {
+				Calldata []string `json:"calldata"`
+			} `json:"request"`
+		}
+		_ = json.Unmarshal(b, &params)
+		tokenId, _ := new(felt.Felt).SetString(params.Request.Calldata[0])
+		res, err := r.Call(ctx, "", "token_uri", []felt.Felt{*tokenId})
+		*call.Result.(*[]felt.Felt) = res
+		call.Err = err
+	}
+	return nil
+}
+
+func TestLoadCollectionBatchesTokenUris(t *testing.T) {
+	rpc := &batchRpc{flakyRpc: &flakyRpc{reverted: map[uint64]bool{7: true}}}
+	config := CollectionConfig{Id: "test", ContractAddress: "0x1", Network: starknet.Mainnet, MinTokenId: 1, MaxTokenId: 10, UriDecoding: UriBase64Json}
+	opts := LoadOptions{Workers: 4, MaxAttempts: 3, BatchSize: 4}
+
+	_, report, err := LoadCollection(context.Background(), rpc, config, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rpc.batches != 3 {
+		t.Fatalf("expected 3 batches, got %d", rpc.batches)
+	}
+	if len(report.Loaded) != 9 || !slices.Equal(report.FailedIds(), []int{7}) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	// prefetched tokens are never fetched one by one
+	for id, n := range rpc.calls {
+		if n != 1 {
+			t.Fatalf("token %d fetched %d times", id, n)
+		}
+	}
+}
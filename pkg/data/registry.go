@@ -0,0 +1,151 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/NethermindEth/juno/core/felt"
+
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+)
+
+// UriDecoding describes how a collection encodes its token_uri
+type UriDecoding string
+
+const (
+	UriAuto       UriDecoding = "auto"
+	UriBase64Json UriDecoding = "base64-json"
+	UriJson       UriDecoding = "json"
+	UriIpfs       UriDecoding = "ipfs"
+	UriHttp       UriDecoding = "http"
+
+	DefaultCollectionId = "blobert"
+)
+
+type CollectionConfig struct {
+	Id              string                   `json:"id"`
+	Name            string                   `json:"name"`
+	ContractAddress string                   `json:"contract_address"`
+	Network         starknet.StarknetNetwork `json:"network"`
+	MinTokenId      int                      `json:"min_token_id"`
+	MaxTokenId      int                      `json:"max_token_id"`
+	UriDecoding     UriDecoding              `json:"uri_decoding"`
+}
+
+var Blobert = CollectionConfig{
+	Id:              DefaultCollectionId,
+	Name:            "Blobert",
+	ContractAddress: "0x00539f522b29ae9251dbf7443c7a950cf260372e69efab3710a11bf17a9599f1",
+	Network:         starknet.Mainnet,
+	MinTokenId:      1,
+	MaxTokenId:      50,
+	UriDecoding:     UriBase64Json,
+}
+
+// Accepts reports whether a token uri of the given kind is expected for this decoding
+func (d UriDecoding) Accepts(kind UriKind) bool {
+	switch d {
+	case UriAuto:
+		return true
+	case UriBase64Json:
+		return kind == KindData
+	case UriJson:
+		return kind == KindJson
+	case UriIpfs:
+		return kind == KindIpfs
+	case UriHttp:
+		return kind == KindHttp
+	}
+	return false
+}
+
+func (c CollectionConfig) Validate() error {
+	if c.Id == "" {
+		return fmt.Errorf("collection id is required")
+	}
+	if _, err := new(felt.Felt).SetString(c.ContractAddress); err != nil {
+		return fmt.Errorf("collection %s: invalid contract address: %w", c.Id, err)
+	}
+	if _, err := starknet.ChainId(c.Network); err != nil {
+		return fmt.Errorf("collection %s: unknown network %q", c.Id, c.Network)
+	}
+	if c.MinTokenId < 0 || c.MaxTokenId < c.MinTokenId {
+		return fmt.Errorf("collection %s: invalid token range [%d, %d]", c.Id, c.MinTokenId, c.MaxTokenId)
+	}
+	if !slices.Contains([]UriDecoding{UriAuto, UriBase64Json, UriJson, UriIpfs, UriHttp}, c.UriDecoding) {
+		return fmt.Errorf("collection %s: unknown uri decoding %q", c.Id, c.UriDecoding)
+	}
+	return nil
+}
+
+// Registry of the NFT collections rooms can be themed with
+type Registry struct {
+	collections map[string]CollectionConfig
+}
+
+func NewRegistry(configs ...CollectionConfig) (*Registry, error) {
+	r := &Registry{collections: make(map[string]CollectionConfig)}
+	for _, c := range configs {
+		if c.UriDecoding == "" {
+			c.UriDecoding = UriAuto
+		}
+		if err := c.Validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := r.collections[c.Id]; ok {
+			return nil, fmt.Errorf("duplicate collection id %s", c.Id)
+		}
+		r.collections[c.Id] = c
+	}
+	return r, nil
+}
+
+// ParseRegistry reads a json array of collection configs
+func ParseRegistry(b []byte) (*Registry, error) {
+	var configs []CollectionConfig
+	if err := json.Unmarshal(b, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse collections: %w", err)
+	}
+	return NewRegistry(configs...)
+}
+
+func LoadRegistry(path string) (*Registry, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRegistry(b)
+}
+
+// RegistryFromEnv reads collections from COLLECTIONS_FILE, or inline json in
+// COLLECTIONS, and falls back to Blobert only.
+func RegistryFromEnv() (*Registry, error) {
+	if path := os.Getenv("COLLECTIONS_FILE"); path != "" {
+		return LoadRegistry(path)
+	}
+	if inline := strings.TrimSpace(os.Getenv("COLLECTIONS")); inline != "" {
+		return ParseRegistry([]byte(inline))
+	}
+	return NewRegistry(Blobert)
+}
+
+func (r *Registry) Get(id string) (CollectionConfig, error) {
+	c, ok := r.collections[id]
+	if !ok {
+		return CollectionConfig{}, fmt.Errorf("unknown collection %s", id)
+	}
+	return c, nil
+}
+
+// List returns the registered collections sorted by id
+func (r *Registry) List() []CollectionConfig {
+	var configs []CollectionConfig
+	for _, c := range r.collections {
+		configs = append(configs, c)
+	}
+	slices.SortFunc(configs, func(a, b CollectionConfig) int { return strings.Compare(a.Id, b.Id) })
+	return configs
+}
@@ -0,0 +1,46 @@
+package data
+
+import (
+	"testing"
+)
+
+func TestParseRegistry(t *testing.T) {
+	r, err := ParseRegistry([]byte(`[
+		{"id": "blobert", "contract_address": "0x00539f522b29ae9251dbf7443c7a950cf260372e69efab3710a11bf17a9599f1", "network": "mainnet", "min_token_id": 1, "max_token_id": 50},
+		{"id": "ducks", "contract_address": "0x0123", "network": "sepolia", "min_token_id": 0, "max_token_id": 99, "uri_decoding": "json"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ducks, err := r.Get("ducks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ducks.UriDecoding != UriJson || ducks.MaxTokenId != 99 {
+		t.Fatalf("unexpected config %+v", ducks)
+	}
+	blobert, err := r.Get("blobert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blobert.UriDecoding != UriAuto {
+		t.Fatalf("expected default uri decoding, got %s", blobert.UriDecoding)
+	}
+	if len(r.List()) != 2 || r.List()[0].Id != "blobert" {
+		t.Fatalf("unexpected list %+v", r.List())
+	}
+}
+
+func TestParseRegistryRejectsInvalidConfig(t *testing.T) {
+	for name, raw := range map[string]string{
+		"duplicate": `[{"id": "a", "contract_address": "0x1", "network": "mainnet", "max_token_id": 1}, {"id": "a", "contract_address": "0x1", "network": "mainnet", "max_token_id": 1}]`,
+		"network":   `[{"id": "a", "contract_address": "0x1", "network": "devnet", "max_token_id": 1}]`,
+		"range":     `[{"id": "a", "contract_address": "0x1", "network": "mainnet", "min_token_id": 5, "max_token_id": 1}]`,
+		"address":   `[{"id": "a", "contract_address": "blobert", "network": "mainnet", "max_token_id": 1}]`,
+	} {
+		if _, err := ParseRegistry([]byte(raw)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package data
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+var (
+	ErrUnsupportedUri  = errors.New("unsupported token uri")
+	ErrMalformedUri    = errors.New("malformed token uri")
+	ErrFetchFailed     = errors.New("failed to fetch token metadata")
+	ErrInvalidMetadata = errors.New("invalid token metadata")
+)
+
+// MetadataError describes which field of the metadata failed validation
+type MetadataError struct {
+	Field  string
+	Reason string
+}
+
+func (e *MetadataError) Error() string {
+	return fmt.Sprintf("invalid token metadata: %s %s", e.Field, e.Reason)
+}
+
+func (e *MetadataError) Is(target error) bool {
+	return target == ErrInvalidMetadata
+}
+
+// FetchError is returned when a remote metadata server answers with an error status
+type FetchError struct {
+	Url        string
+	StatusCode int
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("failed to fetch %s: status code %d", e.Url, e.StatusCode)
+}
+
+func (e *FetchError) Is(target error) bool {
+	return target == ErrFetchFailed
+}
+
+type UriKind string
+
+const (
+	KindData UriKind = "data"
+	KindJson UriKind = "json"
+	KindIpfs UriKind = "ipfs"
+	KindHttp UriKind = "http"
+)
+
+// Kind detects how a token uri is encoded
+func Kind(uri string) (UriKind, error) {
+	uri = strings.TrimSpace(uri)
+	switch {
+	case strings.HasPrefix(uri, "data:"):
+		return KindData, nil
+	case strings.HasPrefix(uri, "{"):
+		return KindJson, nil
+	case strings.HasPrefix(uri, "ipfs://"):
+		return KindIpfs, nil
+	case strings.HasPrefix(uri, "http://"), strings.HasPrefix(uri, "https://"):
+		return KindHttp, nil
+	}
+	return "", errors.Wrapf(ErrUnsupportedUri, "%.32q", uri)
+}
+
+// Fetcher retrieves remote metadata documents
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) ([]byte, error)
+}
+
+type HttpFetcher struct {
+	Client *http.Client
+	// Responses larger than MaxBytes are rejected
+	MaxBytes int64
+}
+
+func NewHttpFetcher() *HttpFetcher {
+	return &HttpFetcher{Client: &http.Client{}, MaxBytes: 4 << 20}
+}
+
+func (f *HttpFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Mark(err, ErrMalformedUri)
+	}
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, errors.Mark(err, ErrFetchFailed)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &FetchError{Url: url, StatusCode: resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.MaxBytes+1))
+	if err != nil {
+		return nil, errors.Mark(err, ErrFetchFailed)
+	}
+	if int64(len(body)) > f.MaxBytes {
+		return nil, errors.Wrapf(ErrFetchFailed, "%s is larger than %d bytes", url, f.MaxBytes)
+	}
+	return body, nil
+}
+
+const DefaultIpfsGateway = "https://ipfs.io/ipfs/"
+
+// Resolver turns a token uri into validated Attributes
+type Resolver struct {
+	Fetcher     Fetcher
+	IpfsGateway string
+}
+
+func NewResolver(fetcher Fetcher) *Resolver {
+	return &Resolver{Fetcher: fetcher, IpfsGateway: DefaultIpfsGateway}
+}
+
+func (r *Resolver) Resolve(ctx context.Context, uri string) (Attributes, error) {
+	payload, err := r.Payload(ctx, uri)
+	if err != nil {
+		return Attributes{}, err
+	}
+	return ParseAttributes(payload)
+}
+
+// Payload returns the raw metadata document pointed at by uri
+func (r *Resolver) Payload(ctx context.Context, uri string) ([]byte, error) {
+	uri = strings.TrimSpace(uri)
+	kind, err := Kind(uri)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case KindData:
+		_, payload, err := DecodeDataUri(uri)
+		return payload, err
+	case KindJson:
+		return []byte(uri), nil
+	case KindIpfs:
+		return r.fetch(ctx, r.IpfsGateway+strings.TrimPrefix(strings.TrimPrefix(uri, "ipfs://"), "ipfs/"))
+	default:
+		return r.fetch(ctx, uri)
+	}
+}
+
+func (r *Resolver) fetch(ctx context.Context, url string) ([]byte, error) {
+	if r.Fetcher == nil {
+		return nil, errors.Wrapf(ErrUnsupportedUri, "no fetcher configured for %s", url)
+	}
+	return r.Fetcher.Fetch(ctx, url)
+}
+
+// DecodeDataUri decodes a RFC 2397 data uri into its media type and payload
+func DecodeDataUri(uri string) (string, []byte, error) {
+	header, payload, ok := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !ok || !strings.HasPrefix(uri, "data:") {
+		return "", nil, errors.Wrap(ErrMalformedUri, "data uri without payload")
+	}
+
+	params := strings.Split(header, ";")
+	mediaType := params[0]
+	if mediaType == "" {
+		mediaType = "text/plain"
+	}
+	isBase64 := params[len(params)-1] == "base64"
+
+	if isBase64 {
+		decoded, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			// some contracts omit the padding
+			decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+		}
+		if err != nil {
+			return "", nil, errors.Mark(errors.Wrap(err, "failed to decode base64 payload"), ErrMalformedUri)
+		}
+		return mediaType, decoded, nil
+	}
+
+	decoded, err := url.PathUnescape(payload)
+	if err != nil {
+		// on chain metadata is often not escaped at all
+		decoded = payload
+	}
+	return mediaType, []byte(decoded), nil
+}
+
+// ParseAttributes parses and validates a metadata json document
+func ParseAttributes(payload []byte) (Attributes, error) {
+	var attr Attributes
+	if err := json.Unmarshal(payload, &attr); err != nil {
+		return Attributes{}, errors.Mark(errors.Wrap(err, "failed to parse metadata json"), ErrInvalidMetadata)
+	}
+	if err := attr.Validate(); err != nil {
+		return Attributes{}, err
+	}
+	return attr, nil
+}
+
+func (a Attributes) Validate() error {
+	if strings.TrimSpace(a.Name) == "" {
+		return &MetadataError{Field: "name", Reason: "is empty"}
+	}
+	if a.Image != "" {
+		if kind, err := Kind(a.Image); err != nil || kind == KindJson {
+			return &MetadataError{Field: "image", Reason: "is not a supported uri"}
+		}
+	}
+	for i, attr := range a.Attributes {
+		if _, ok := attr["value"]; !ok {
+			return &MetadataError{Field: fmt.Sprintf("attributes[%d]", i), Reason: "has no value"}
+		}
+	}
+	return nil
+}
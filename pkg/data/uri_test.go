@@ -0,0 +1,116 @@
+package data
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+)
+
+func fixture(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// fixtureFetcher serves fixture files by url
+type fixtureFetcher map[string]string
+
+func (f fixtureFetcher) Fetch(_ context.Context, url string) ([]byte, error) {
+	payload, ok := f[url]
+	if !ok {
+		return nil, &FetchError{Url: url, StatusCode: http.StatusNotFound}
+	}
+	return []byte(payload), nil
+}
+
+func TestResolveInlineUris(t *testing.T) {
+	r := NewResolver(nil)
+	for _, name := range []string{"base64.txt", "utf8.txt", "percent.txt", "plain.json"} {
+		attr, err := r.Resolve(context.Background(), fixture(t, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if attr.Name != "Blobert #12" || len(attr.Attributes) != 2 || attr.Attributes[0]["value"] != "Sheep Wool" {
+			t.Fatalf("%s: unexpected attributes %+v", name, attr)
+		}
+	}
+}
+
+func TestResolveIpfsUri(t *testing.T) {
+	r := NewResolver(fixtureFetcher{
+		"https://gateway.test/ipfs/bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi/7.json": fixture(t, "remote.json"),
+	})
+	r.IpfsGateway = "https://gateway.test/ipfs/"
+
+	attr, err := r.Resolve(context.Background(), "ipfs://bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi/7.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attr.Name != "Duck #7" || attr.Attributes[0]["value"] != float64(3) {
+		t.Fatalf("unexpected attributes %+v", attr)
+	}
+
+	_, err = r.Resolve(context.Background(), "ipfs://missing")
+	if !errors.Is(err, ErrFetchFailed) {
+		t.Fatalf("expected ErrFetchFailed, got %v", err)
+	}
+}
+
+func TestResolveHttpUri(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/7.json" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(fixture(t, "remote.json")))
+	}))
+	defer srv.Close()
+
+	r := NewResolver(NewHttpFetcher())
+	attr, err := r.Resolve(context.Background(), srv.URL+"/7.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attr.Name != "Duck #7" {
+		t.Fatalf("unexpected attributes %+v", attr)
+	}
+
+	_, err = r.Resolve(context.Background(), srv.URL+"/8.json")
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) || fetchErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 FetchError, got %v", err)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	r := NewResolver(nil)
+	for uri, target := range map[string]error{
+		"ar://tx":                              ErrUnsupportedUri,
+		"data:application/json":                ErrMalformedUri,
+		"data:application/json;base64,!!!":     ErrMalformedUri,
+		"data:application/json;utf8,{\"name\"": ErrInvalidMetadata,
+		fixture(t, "missing_name.json"):        ErrInvalidMetadata,
+		fixture(t, "bad_image.json"):           ErrInvalidMetadata,
+		"https://example.com/1.json":           ErrUnsupportedUri,
+	} {
+		_, err := r.Resolve(context.Background(), uri)
+		if !errors.Is(err, target) {
+			t.Errorf("%.40s: expected %v, got %v", uri, target, err)
+		}
+	}
+
+	_, err := r.Resolve(context.Background(), fixture(t, "missing_name.json"))
+	var metaErr *MetadataError
+	if !errors.As(err, &metaErr) || metaErr.Field != "name" {
+		t.Fatalf("expected name MetadataError, got %v", err)
+	}
+}
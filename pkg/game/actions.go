@@ -1,13 +1,20 @@
 package game
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/NethermindEth/juno/core/felt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/websocket"
+
+	"github.com/MartianGreed/memo-backend/pkg/metrics"
+	"github.com/MartianGreed/memo-backend/pkg/tracing"
 )
 
 // Do not keep blobs for too long
@@ -35,13 +42,42 @@ func (c *ConnectionBuf) resetActions() {
 
 type ConnectionPool struct {
 	Connections map[*websocket.Conn]*ConnectionBuf
+	// players who registered a key, their reveals must be signed
+	Players map[*websocket.Conn]*Player
 	sync.RWMutex
+
+	// reveals waiting to be hidden, drained on shutdown
+	pending sync.WaitGroup
+	closing bool
 }
 
 func NewConnectionPool() *ConnectionPool {
 	return &ConnectionPool{
 		Connections: map[*websocket.Conn]*ConnectionBuf{},
+		Players:     map[*websocket.Conn]*Player{},
+	}
+}
+
+// Join adds a connection and its player, nil for anonymous ones. It reports
+// false once the pool is shutting down.
+func (cp *ConnectionPool) Join(ws *websocket.Conn, buf *ConnectionBuf, player *Player) bool {
+	cp.Lock()
+	defer cp.Unlock()
+	if cp.closing {
+		return false
+	}
+	cp.Connections[ws] = buf
+	if player != nil {
+		cp.Players[ws] = player
 	}
+	return true
+}
+
+func (cp *ConnectionPool) Leave(ws *websocket.Conn) {
+	cp.Lock()
+	defer cp.Unlock()
+	delete(cp.Connections, ws)
+	delete(cp.Players, ws)
 }
 
 type (
@@ -49,10 +85,19 @@ type (
 		Event string
 		X     int
 		Y     int
+		// signed reveals carry the player move index and the [r, s] signature of
+		// MoveTypedData
+		Index     int          `json:"index,omitempty"`
+		Signature []*felt.Felt `json:"signature,omitempty"`
+		// authorization of user.authorize-session
+		Session *Session `json:"session,omitempty"`
 	}
 	UserHello struct {
 		Event string `json:"event"`
 		Name  string `json:"name"`
+		// optional, players providing both sign their moves
+		Account   *felt.Felt `json:"account,omitempty"`
+		PublicKey *felt.Felt `json:"public_key,omitempty"`
 	}
 	UserRevealCardAction struct {
 		Type string
@@ -86,17 +131,52 @@ type (
 //	if same user sends another request within 2s reveal the other card if two matches mark them as revealed and send picture
 //
 // system.hide-card - send object with false and position
-func HandleMessage(ua UserAction, board *Board, ws *websocket.Conn, cp *ConnectionPool) error {
+// user.authorize-session - let a session key sign the next moves, answered with system.session-authorized
+// user.revoke-session - end the current session, answered with system.session-revoked
+func HandleMessage(ctx context.Context, ua UserAction, board *Board, ws *websocket.Conn, cp *ConnectionPool) (err error) {
+	metrics.Message(ua.Event)
+	cp.RLock()
+	player, closing := cp.Players[ws], cp.closing
+	cp.RUnlock()
+	if closing {
+		return ErrShuttingDown
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "game.HandleMessage", trace.WithAttributes(
+		attribute.String("game.event", ua.Event),
+		attribute.Bool("game.signed", player != nil),
+	))
+	defer func() { tracing.End(span, err) }()
+
 	switch ua.Event {
+	case "user.authorize-session":
+		if err := authorizeSession(ua, board, player); err != nil {
+			return err
+		}
+		sendSessionMessage(ws, "system.session-authorized", ua.Session)
+	case "user.revoke-session":
+		s, err := revokeSession(ua, board, player)
+		if err != nil {
+			return err
+		}
+		sendSessionMessage(ws, "system.session-revoked", s)
 	case "user.hover-card":
-		sendSystemHoverCard(cp, SystemHoverCardMessage{Event: "system.hover-card", X: ua.X, Y: ua.Y, Name: cp.Connections[ws].Name})
+		sendSystemHoverCard(ctx, cp, SystemHoverCardMessage{Event: "system.hover-card", X: ua.X, Y: ua.Y, Name: cp.Connections[ws].Name})
 	case "user.leave-card":
-		sendSystemHoverCard(cp, SystemHoverCardMessage{Event: "system.leave-card", X: ua.X, Y: ua.Y, Name: cp.Connections[ws].Name})
+		sendSystemHoverCard(ctx, cp, SystemHoverCardMessage{Event: "system.leave-card", X: ua.X, Y: ua.Y, Name: cp.Connections[ws].Name})
 	case "user.reveal-card":
+		move, err := verifyMove(ua, board, player)
+		if err != nil {
+			return err
+		}
+		if move != nil {
+			board.RecordMove(*move)
+		}
+
 		incrementUserActionCounter(cp, ws, ua)
 		_ = cp.Connections[ws]
-		go sendSystemRevealCard(board, cp, ua)
-		go hideCardAfterTimeout(board, cp, ws, ua)
+		cp.track(func() { sendSystemRevealCard(ctx, board, cp, ua) })
+		cp.track(func() { hideCardAfterTimeout(ctx, board, cp, ws, ua) })
 
 		if len(cp.Connections[ws].actions) > 1 {
 			prevActionIdx := len(cp.Connections[ws].actions) - 2
@@ -106,11 +186,14 @@ func HandleMessage(ua UserAction, board *Board, ws *websocket.Conn, cp *Connecti
 			// if prev.Name == curr.Name && cp.Connections[ws].actions[prevActionIdx].X != ua.X && cp.Connections[ws].actions[prevActionIdx].Y != ua.Y {
 			if prev.Name == curr.Name {
 				// do not hide the cards
-				board.Revealed[cp.Connections[ws].actions[prevActionIdx].X][cp.Connections[ws].actions[prevActionIdx].Y].Revealed = true
-				board.Revealed[cp.Connections[ws].actions[prevActionIdx].X][cp.Connections[ws].actions[prevActionIdx].Y].Attr = &board.grid[ua.X][ua.Y]
-				board.Revealed[ua.X][ua.Y].Revealed = true
-				board.Revealed[ua.X][ua.Y].Attr = &board.grid[cp.Connections[ws].actions[prevActionIdx].X][cp.Connections[ws].actions[prevActionIdx].Y]
+				matched, finished := board.match(cp.Connections[ws].actions[prevActionIdx].X, cp.Connections[ws].actions[prevActionIdx].Y, ua.X, ua.Y)
 				// execute match_tiles onchain
+				if matched {
+					metrics.Matches.Inc()
+				}
+				if finished {
+					metrics.MatchesPerGame.Observe(float64(board.Matches()))
+				}
 
 				cp.Connections[ws].resetActions()
 			}
@@ -128,10 +211,18 @@ func incrementUserActionCounter(cp *ConnectionPool, ws *websocket.Conn, ua UserA
 	}
 }
 
-func sendToConnectionPool(cp *ConnectionPool, t string, msg interface{}) {
+func sendToConnectionPool(ctx context.Context, cp *ConnectionPool, t string, msg interface{}) {
+	start := time.Now()
+	defer func() { metrics.Broadcast.WithLabelValues(t).Observe(time.Since(start).Seconds()) }()
+	_, span := tracing.Tracer().Start(ctx, "game.broadcast", trace.WithAttributes(
+		attribute.String("game.event", t),
+		attribute.Int("game.connections", len(cp.Connections)),
+	))
+	defer span.End()
 	for connection := range cp.Connections {
 		err := websocket.JSON.Send(connection, msg)
 		if err != nil {
+			span.RecordError(err)
 			slog.Error(fmt.Sprintf("failed to send %s to %s", t, connection.Request().Header.Get("Sec-Websocket-Key")))
 			// FIX: very odd but does not seem to have a case to handle those cases
 			if strings.Contains(err.Error(), "write: broken pipe") {
@@ -143,29 +234,30 @@ func sendToConnectionPool(cp *ConnectionPool, t string, msg interface{}) {
 	}
 }
 
-func sendSystemHoverCard(cp *ConnectionPool, a SystemHoverCardMessage) {
+func sendSystemHoverCard(ctx context.Context, cp *ConnectionPool, a SystemHoverCardMessage) {
 	rcm := SystemHoverCardMessage{
 		Event: a.Event,
 		X:     a.X,
 		Y:     a.Y,
 		Name:  a.Name,
 	}
-	sendToConnectionPool(cp, "system.hover-card", rcm)
+	sendToConnectionPool(ctx, cp, "system.hover-card", rcm)
 }
 
-func sendSystemRevealCard(board *Board, cp *ConnectionPool, ua UserAction) {
+func sendSystemRevealCard(ctx context.Context, board *Board, cp *ConnectionPool, ua UserAction) {
 	rcm := SystemRevealCardMessage{
 		Event:     "system.reveal-card",
 		Attribute: Tile{Attr: &board.grid[ua.X][ua.Y], Revealed: true},
 		X:         ua.X,
 		Y:         ua.Y,
 	}
-	sendToConnectionPool(cp, "system.reveal-card", rcm)
+	sendToConnectionPool(ctx, cp, "system.reveal-card", rcm)
 }
 
-func sendSystemHideCard(b *Board, cp *ConnectionPool, action SystemHideCardMessage) {
-	if b.Revealed[action.X][action.Y].Revealed {
-		return
+// sendSystemHideCard reports whether the card was hidden, matched cards stay visible
+func sendSystemHideCard(ctx context.Context, b *Board, cp *ConnectionPool, action SystemHideCardMessage) bool {
+	if b.isRevealed(action.X, action.Y) {
+		return false
 	}
 
 	rcm := SystemHideCardMessage{
@@ -174,7 +266,8 @@ func sendSystemHideCard(b *Board, cp *ConnectionPool, action SystemHideCardMessa
 		X:         action.X,
 		Y:         action.Y,
 	}
-	sendToConnectionPool(cp, "system.hide-card", rcm)
+	sendToConnectionPool(ctx, cp, "system.hide-card", rcm)
+	return true
 }
 
 func startTimer(b *Board, cp *ConnectionPool, ws *websocket.Conn, action UserAction) {
@@ -185,7 +278,7 @@ func startTimer(b *Board, cp *ConnectionPool, ws *websocket.Conn, action UserAct
 		cp.Lock()
 		defer cp.Unlock()
 		cp.Connections[ws] = &ConnectionBuf{Name: cp.Connections[ws].Name}
-		sendSystemHideCard(b, cp, SystemHideCardMessage{Event: "system.hide-card", X: action.X, Y: action.Y})
+		sendSystemHideCard(context.Background(), b, cp, SystemHideCardMessage{Event: "system.hide-card", X: action.X, Y: action.Y})
 	})
 	cp.Connections[ws] = &ConnectionBuf{timer: t, x: action.X, y: action.Y, Name: cp.Connections[ws].Name}
 }
@@ -212,14 +305,18 @@ func resetTimer(b *Board, cp *ConnectionPool, ws *websocket.Conn, ua UserAction)
 		cp.Lock()
 		defer cp.Unlock()
 
-		sendSystemHideCard(b, cp, SystemHideCardMessage{Event: "system.hide-card", X: cp.Connections[ws].x, Y: cp.Connections[ws].y})
-		sendSystemHideCard(b, cp, SystemHideCardMessage{Event: "system.hide-card", X: ua.X, Y: ua.Y})
+		sendSystemHideCard(context.Background(), b, cp, SystemHideCardMessage{Event: "system.hide-card", X: cp.Connections[ws].x, Y: cp.Connections[ws].y})
+		sendSystemHideCard(context.Background(), b, cp, SystemHideCardMessage{Event: "system.hide-card", X: ua.X, Y: ua.Y})
 		cp.Connections[ws] = &ConnectionBuf{timer: nil, Name: c.Name}
 	})
 	cp.Connections[ws] = &ConnectionBuf{timer: t, x2: ua.X, y2: ua.Y, Name: c.Name}
 }
 
-func hideCardAfterTimeout(b *Board, cp *ConnectionPool, ws *websocket.Conn, ua UserAction) {
+// the hide broadcast stays in the trace of the reveal that scheduled it
+func hideCardAfterTimeout(ctx context.Context, b *Board, cp *ConnectionPool, ws *websocket.Conn, ua UserAction) {
+	revealedAt := time.Now()
 	<-time.After(RevealTimeout)
-	sendSystemHideCard(b, cp, SystemHideCardMessage{Event: "system.hide-card", X: ua.X, Y: ua.Y})
+	if sendSystemHideCard(ctx, b, cp, SystemHideCardMessage{Event: "system.hide-card", X: ua.X, Y: ua.Y}) {
+		metrics.RevealToHide.Observe(time.Since(revealedAt).Seconds())
+	}
 }
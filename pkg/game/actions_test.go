@@ -0,0 +1,140 @@
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/MartianGreed/memo-backend/pkg/metrics"
+	"github.com/MartianGreed/memo-backend/pkg/signer"
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+)
+
+func TestHandleMessageSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	b, err := CreateBoard(testCollection(), Seed{Server: starknet.FeltFromInt(7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := signer.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := serverConn(t)
+	cp := NewConnectionPool()
+	cp.Connections[ws] = &ConnectionBuf{Name: "alice"}
+
+	if err := HandleMessage(context.Background(), UserAction{Event: "user.hover-card", X: 1, Y: 1}, b, ws, cp); err != nil {
+		t.Fatal(err)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 2 || spans[0].Name() != "game.broadcast" || spans[1].Name() != "game.HandleMessage" {
+		t.Fatalf("expected the broadcast nested in the message, got %d spans", len(spans))
+	}
+	if spans[0].Parent().SpanID() != spans[1].SpanContext().SpanID() {
+		t.Fatal("broadcast span is not a child of the message span")
+	}
+
+	// rejected moves mark the span as failed
+	cp.Players[ws] = UserHello{Account: starknet.FeltFromInt(0xacc), PublicKey: key.PublicKey()}.player()
+	if err := HandleMessage(context.Background(), UserAction{Event: "user.reveal-card", X: 1, Y: 2}, b, ws, cp); err == nil {
+		t.Fatal("expected the unsigned reveal to be rejected")
+	}
+	spans = recorder.Ended()
+	if last := spans[len(spans)-1]; last.Status().Code != codes.Error {
+		t.Fatalf("expected an error status, got %v", last.Status())
+	}
+}
+
+// run with -race, the api reads the board while players match tiles
+func TestBoardSnapshotWhilePlaying(t *testing.T) {
+	b, err := CreateBoard(testCollection(), Seed{Server: starknet.FeltFromInt(9)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < Cols; i += 2 {
+			b.match(0, i, 0, i+1)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_ = b.RevealedTiles()
+		_ = b.Finished()
+		if _, err := json.Marshal(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	if tiles := b.RevealedTiles(); !tiles[0][0].Revealed || tiles[0][0].Attr != &b.grid[0][1] {
+		t.Fatal("expected matched tiles to show each other")
+	}
+}
+
+func TestMatchReportsTheEndOfTheGame(t *testing.T) {
+	b, err := CreateBoard(testCollection(), Seed{Server: starknet.FeltFromInt(11)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a tile is no pair of its own
+	if matched, _ := b.match(0, 0, 0, 0); matched || b.Matches() != 0 || b.isRevealed(0, 0) {
+		t.Fatalf("expected a tile matched with itself to be ignored, got %d matches", b.Matches())
+	}
+	finishedAt := -1
+	for i := 0; i < Rows; i++ {
+		for j := 0; j < Cols; j += 2 {
+			matched, finished := b.match(i, j, i, j+1)
+			if !matched {
+				t.Fatalf("expected (%d, %d) and (%d, %d) to match", i, j, i, j+1)
+			}
+			if finished {
+				finishedAt = b.Matches()
+			}
+		}
+	}
+	if finishedAt != PairCount {
+		t.Fatalf("expected the last of %d matches to finish the game, got %d", PairCount, finishedAt)
+	}
+	// matching revealed tiles again is not counted
+	if matched, finished := b.match(0, 0, 0, 1); matched || finished || b.Matches() != PairCount {
+		t.Fatalf("expected %d matches, got %d", PairCount, b.Matches())
+	}
+}
+
+func TestRevealingATileTwiceIsNoMatch(t *testing.T) {
+	b, err := CreateBoard(testCollection(), Seed{Server: starknet.FeltFromInt(12)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := func() float64 {
+		var m dto.Metric
+		if err := metrics.Matches.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetCounter().GetValue()
+	}
+	ws := serverConn(t)
+	cp := NewConnectionPool()
+	cp.Connections[ws] = &ConnectionBuf{Name: "alice"}
+
+	before := matches()
+	for i := 0; i < 2; i++ {
+		if err := HandleMessage(context.Background(), UserAction{Event: "user.reveal-card", X: 1, Y: 1}, b, ws, cp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b.Matches() != 0 || matches() != before {
+		t.Fatalf("expected no match, got %d on the board and %v counted", b.Matches(), matches()-before)
+	}
+}
@@ -1,7 +1,11 @@
 package game
 
 import (
-	"math/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
 
 	"github.com/NethermindEth/juno/core/felt"
 
@@ -10,17 +14,38 @@ import (
 	"github.com/NethermindEth/juno/core/crypto"
 )
 
+const (
+	Rows      = 6
+	Cols      = 10
+	PairCount = Rows * Cols / 2
+)
+
+var (
+	ErrMissingServerSeed = errors.New("missing server seed")
+	ErrGameNotFinished   = errors.New("game has not finished yet")
+)
+
 type Tile struct {
 	Attr     *data.Attributes `json:"attr"`
 	Revealed bool             `json:"revealed"`
 }
 type Board struct {
-	grid     [][]data.Attributes `json:"grid"`
-	secrets   []FeltPair
-	pubkeys   []*felt.Felt
-	Revealed [][]Tile            `json:"revealed"`
-	priv_g1 felt.Felt
-	priv_g2 felt.Felt
+	grid         [][]data.Attributes
+	secrets      []FeltPair
+	pubkeys      []*felt.Felt
+	seed         Seed
+	CollectionId string     `json:"collection_id"`
+	Commitment   *felt.Felt `json:"commitment"`
+	// chain the moves are signed for, the commitment doubles as the game id
+	ChainId *felt.Felt `json:"chain_id,omitempty"`
+	// written by the websocket handlers, read it through RevealedTiles
+	Revealed [][]Tile `json:"revealed"`
+	priv_g1  felt.Felt
+	priv_g2  felt.Felt
+	record   *moveRecord
+	// guards Revealed and matches, a pointer as GenMatchProof takes the board by value
+	mu      *sync.RWMutex
+	matches int
 }
 
 type FeltPair struct {
@@ -33,12 +58,19 @@ type DistinguishedPair struct {
 	other bool
 }
 
-func CreateBoard(collection *data.Collection) *Board {
-	server_seed := starknet.FeltFromInt(rand.Intn(9999999))
-	priv_g1 := starknet.FeltFromInt(rand.Intn(9999999) + 1)
-	priv_g2 := starknet.FeltFromInt(rand.Intn(9999999) + 1)
+// CreateBoard lays out the board using only the randomness derived from seed,
+// so the same seed and collection always produce the same board.
+func CreateBoard(collection *data.Collection, seed Seed) (*Board, error) {
+	if seed.Server == nil {
+		return nil, ErrMissingServerSeed
+	}
+	r := seed.Rand()
+	server_seed := seed.Server
 
-	pairs := collection.GetPairs()
+	pairs, err := pickPairs(collection, r)
+	if err != nil {
+		return nil, err
+	}
 	var originals []DistinguishedPair
 	var copies []DistinguishedPair
 	var tiles []DistinguishedPair
@@ -47,17 +79,21 @@ func CreateBoard(collection *data.Collection) *Board {
 	copies = Map(pairs, func(p data.Attributes) DistinguishedPair { return DistinguishedPair{data: p, other: true} })
 	tiles = append(originals, copies...)
 
-	rand.Shuffle(len(tiles), func(i, j int) { tiles[i], tiles[j] = tiles[j], tiles[i] })
+	r.Shuffle(len(tiles), func(i, j int) { tiles[i], tiles[j] = tiles[j], tiles[i] })
+
+	priv_g1 := starknet.FeltFromInt(r.IntN(9999999) + 1)
+	priv_g2 := starknet.FeltFromInt(r.IntN(9999999) + 1)
 
 	// create 6x10 grid
 	// place randomly 30 pairs of cards
 	var grid [][]data.Attributes
 	var secrets []FeltPair
+	var revealed [][]Tile
 
 	count := 0
-	for i := 0; i < 6; i++ {
+	for i := 0; i < Rows; i++ {
 		var row []data.Attributes
-		for j := 0; j < 10; j++ {
+		for j := 0; j < Cols; j++ {
 			row = append(row, tiles[count].data)
 
 			tokenId := starknet.FeltFromInt(tiles[count].data.TokenId)
@@ -66,25 +102,154 @@ func CreateBoard(collection *data.Collection) *Board {
 			count++
 		}
 		grid = append(grid, row)
+		revealed = append(revealed, make([]Tile, Cols))
 	}
 
 	pubkeys := GenPublicKeys(secrets, *priv_g1, *priv_g2)
 
 	return &Board{
-		grid: grid,
-		Revealed: [][]Tile{
-			make([]Tile, 10),
-			make([]Tile, 10),
-			make([]Tile, 10),
-			make([]Tile, 10),
-			make([]Tile, 10),
-			make([]Tile, 10),
-		},
-		secrets: secrets,
-		pubkeys: pubkeys,
-		priv_g1: *priv_g1,
-		priv_g2: *priv_g2,
+		grid:         grid,
+		Revealed:     revealed,
+		secrets:      secrets,
+		pubkeys:      pubkeys,
+		seed:         seed,
+		CollectionId: collection.Id(),
+		Commitment:   seed.Commitment(),
+		priv_g1:      *priv_g1,
+		priv_g2:      *priv_g2,
+		record:       &moveRecord{},
+		mu:           &sync.RWMutex{},
+	}, nil
+}
+
+func pickPairs(collection *data.Collection, r *rand.Rand) ([]data.Attributes, error) {
+	ids := collection.TokenIds()
+	if len(ids) < PairCount {
+		return nil, fmt.Errorf("collection has %d tokens, need at least %d", len(ids), PairCount)
 	}
+	r.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+
+	var pairs []data.Attributes
+	for _, id := range ids[:PairCount] {
+		pairs = append(pairs, collection.Get(id))
+	}
+	return pairs, nil
+}
+
+// Layout returns the token id placed on each tile
+func (b *Board) Layout() [][]int {
+	var layout [][]int
+	for _, row := range b.grid {
+		layout = append(layout, Map(row, func(a data.Attributes) int { return a.TokenId }))
+	}
+	return layout
+}
+
+func (b *Board) PublicKeys() []*felt.Felt {
+	return b.pubkeys
+}
+
+// RevealedTiles returns a copy of the revealed tiles
+func (b *Board) RevealedTiles() [][]Tile {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	tiles := make([][]Tile, len(b.Revealed))
+	for i, row := range b.Revealed {
+		tiles[i] = append([]Tile(nil), row...)
+	}
+	return tiles
+}
+
+// MarshalJSON serializes a snapshot of the board
+func (b *Board) MarshalJSON() ([]byte, error) {
+	type board Board
+	snapshot := board(*b)
+	snapshot.Revealed = b.RevealedTiles()
+	return json.Marshal(snapshot)
+}
+
+func (b *Board) isRevealed(x int, y int) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.Revealed[x][y].Revealed
+}
+
+// match reveals two tiles for good, each showing the attributes of the other.
+// It reports whether they were a new pair, a tile matched with itself or with
+// an already matched one is not, and whether this match finished the game.
+func (b *Board) match(x1 int, y1 int, x2 int, y2 int) (matched bool, finished bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if (x1 == x2 && y1 == y2) || b.Revealed[x1][y1].Revealed || b.Revealed[x2][y2].Revealed {
+		return false, false
+	}
+	b.matches++
+	b.Revealed[x1][y1] = Tile{Attr: &b.grid[x2][y2], Revealed: true}
+	b.Revealed[x2][y2] = Tile{Attr: &b.grid[x1][y1], Revealed: true}
+	return true, b.finished()
+}
+
+// Matches is the number of pairs matched so far
+func (b *Board) Matches() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.matches
+}
+
+// Finished reports whether every pair has been matched
+func (b *Board) Finished() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.finished()
+}
+
+func (b *Board) finished() bool {
+	for _, row := range b.Revealed {
+		for _, t := range row {
+			if !t.Revealed {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// RevealSeed discloses the seeds once the game is over so anyone can replay the board
+func (b *Board) RevealSeed() (Seed, error) {
+	if !b.Finished() {
+		return Seed{}, ErrGameNotFinished
+	}
+	return b.seed, nil
+}
+
+// MatchProof shows two tiles, by row major index, hide the same token without
+// disclosing the secret key
+type MatchProof struct {
+	Tiles [2]int     `json:"tiles"`
+	C     *felt.Felt `json:"c"`
+	S     *felt.Felt `json:"s"`
+}
+
+// MatchProofs proves every pair of the board once the game is over
+func (b *Board) MatchProofs() ([]MatchProof, error) {
+	if !b.Finished() {
+		return nil, ErrGameNotFinished
+	}
+	var proofs []MatchProof
+	first := map[int]int{}
+	for i, row := range b.grid {
+		for j, attr := range row {
+			index := i*Cols + j
+			other, ok := first[attr.TokenId]
+			if !ok {
+				first[attr.TokenId] = index
+				continue
+			}
+			c, s := GenMatchProof(*b, other, index, b.secrets[other].key)
+			proofs = append(proofs, MatchProof{Tiles: [2]int{other, index}, C: &c, S: &s})
+		}
+	}
+	return proofs, nil
 }
 
 func Map[T, U any](ts []T, f func(T) U) []U {
@@ -94,4 +259,3 @@ func Map[T, U any](ts []T, f func(T) U) []U {
 	}
 	return us
 }
-
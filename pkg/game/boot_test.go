@@ -0,0 +1,75 @@
+package game
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MartianGreed/memo-backend/pkg/cache"
+	"github.com/MartianGreed/memo-backend/pkg/data"
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+	"github.com/MartianGreed/memo-backend/pkg/starknet/starknettest"
+)
+
+// TestBootFromFakeNode runs the server boot path against an in-process node
+func TestBootFromFakeNode(t *testing.T) {
+	ctx := context.Background()
+	node := starknettest.NewNode(t)
+	address := starknet.FeltFromInt(0xb10b)
+	node.DeployCollection(address, 1, 50, starknettest.Base64JsonUri)
+
+	config := data.CollectionConfig{
+		Id:              "test",
+		Name:            "Test",
+		ContractAddress: address.String(),
+		Network:         starknet.Mainnet,
+		MinTokenId:      1,
+		MaxTokenId:      50,
+		UriDecoding:     data.UriBase64Json,
+	}
+	rpc := node.Client()
+	if err := rpc.VerifyChainId(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := data.DefaultLoadOptions
+	opts.Cache = cache.New(t.TempDir(), 0)
+	opts.RenderImages = true
+	collection, report, err := data.LoadCollection(ctx, rpc, config, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Complete() || len(collection.TokenIds()) != 50 {
+		t.Fatalf("collection not fully loaded, failed %v", report.FailedIds())
+	}
+	if attr := collection.Get(7); attr.Name != "Token #7" || attr.Image == "" {
+		t.Fatalf("unexpected token 7 %+v", attr)
+	}
+
+	board, err := CreateBoard(collection, Seed{Server: starknet.FeltFromInt(42), BlockHash: starknettest.BlockHash(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[int]int)
+	for _, row := range board.Layout() {
+		for _, tokenId := range row {
+			counts[tokenId]++
+		}
+	}
+	if len(counts) != PairCount {
+		t.Fatalf("expected %d pairs, got %d", PairCount, len(counts))
+	}
+	for tokenId, count := range counts {
+		if count != 2 {
+			t.Fatalf("token %d placed %d times", tokenId, count)
+		}
+	}
+
+	// a second boot is served from the cache
+	calls := node.Calls("starknet_call")
+	if _, _, err := data.LoadCollection(ctx, rpc, config, opts); err != nil {
+		t.Fatal(err)
+	}
+	if node.Calls("starknet_call") != calls {
+		t.Fatalf("expected no rpc calls on a warm cache, got %d", node.Calls("starknet_call")-calls)
+	}
+}
@@ -0,0 +1,251 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/NethermindEth/juno/core/felt"
+
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+)
+
+// Reject reveals of players who did not register a public key
+var RequireSignedMoves = false
+
+var (
+	ErrUnsignedMove         = errors.New("move is not signed")
+	ErrInvalidMoveSignature = errors.New("invalid move signature")
+	ErrUnexpectedMoveIndex  = errors.New("unexpected move index")
+	ErrAccountKeyMismatch   = errors.New("public key does not belong to the account")
+)
+
+// accountAbi is the part of the OpenZeppelin account interface telling the key of an account
+var accountAbi = starknet.MustParseAbi(`[
+	{
+		"type": "function",
+		"name": "get_public_key",
+		"inputs": [],
+		"outputs": [{"type": "core::felt252"}],
+		"state_mutability": "view"
+	}
+]`)
+
+// gameTypes of the SNIP-12 (revision 1) messages players sign
+var gameTypes = map[string][]starknet.TypedDataParam{
+	"StarknetDomain": {
+		{Name: "name", Type: "shortstring"},
+		{Name: "version", Type: "shortstring"},
+		{Name: "chainId", Type: "shortstring"},
+		{Name: "revision", Type: "shortstring"},
+	},
+	"Move": {
+		{Name: "game_id", Type: "felt"},
+		{Name: "index", Type: "u128"},
+		{Name: "x", Type: "u128"},
+		{Name: "y", Type: "u128"},
+	},
+	"Session": {
+		{Name: "session_key", Type: "felt"},
+		{Name: "game_id", Type: "felt"},
+		{Name: "expires", Type: "timestamp"},
+	},
+	"Revocation": {
+		{Name: "session_key", Type: "felt"},
+		{Name: "game_id", Type: "felt"},
+	},
+}
+
+type (
+	// Player is the onchain identity a connection plays with, moves are signed
+	// by the stark key of the account.
+	Player struct {
+		Account   *felt.Felt
+		PublicKey *felt.Felt
+		// guards moves and session, the api reads them while the player is playing
+		mu sync.Mutex
+		// index the next move must carry
+		moves int
+		// session key allowed to sign on behalf of the account
+		session *Session
+	}
+	// SignedMove is a reveal as signed by the player, kept in the game record
+	SignedMove struct {
+		GameId    *felt.Felt   `json:"game_id"`
+		ChainId   *felt.Felt   `json:"chain_id"`
+		Account   *felt.Felt   `json:"account"`
+		PublicKey *felt.Felt   `json:"public_key"`
+		Index     int          `json:"index"`
+		X         int          `json:"x"`
+		Y         int          `json:"y"`
+		Signature []*felt.Felt `json:"signature"`
+		// set when the move is signed by a session key
+		Session *Session `json:"session,omitempty"`
+	}
+)
+
+// moveRecord is shared by the copies of a board
+type moveRecord struct {
+	mu      sync.Mutex
+	moves   []SignedMove
+	revoked map[felt.Felt]struct{}
+}
+
+// RecordMove appends a verified move to the game record
+func (b *Board) RecordMove(m SignedMove) {
+	b.record.mu.Lock()
+	defer b.record.mu.Unlock()
+	b.record.moves = append(b.record.moves, m)
+}
+
+// Moves returns the signed moves played so far, in order, so the game can be
+// audited or settled onchain.
+func (b *Board) Moves() []SignedMove {
+	b.record.mu.Lock()
+	defer b.record.mu.Unlock()
+	return append([]SignedMove(nil), b.record.moves...)
+}
+
+// player returns the identity announced in the hello, nil for anonymous players
+func (h UserHello) player() *Player {
+	if h.Account == nil || h.PublicKey == nil {
+		return nil
+	}
+	return &Player{Account: h.Account, PublicKey: h.PublicKey}
+}
+
+// Player returns the identity announced in the hello once the account contract
+// confirmed the public key is its own, nil for anonymous players. Anyone can
+// claim an account, only its key proves the moves are the ones of its owner.
+func (h UserHello) Player(ctx context.Context, accounts starknet.StarknetRpcClient) (*Player, error) {
+	player := h.player()
+	if player == nil {
+		return nil, nil
+	}
+	outputs, err := accountAbi.Call(ctx, accounts, h.Account.String(), "get_public_key")
+	if err != nil {
+		return nil, fmt.Errorf("public key of account %s: %w", h.Account, err)
+	}
+	if key := outputs[0].(*felt.Felt); !key.Equal(h.PublicKey) {
+		return nil, fmt.Errorf("%w: %s", ErrAccountKeyMismatch, h.Account)
+	}
+	return player, nil
+}
+
+func gameTypedData(chainId *felt.Felt, primaryType string, message map[string]any) *starknet.TypedData {
+	return &starknet.TypedData{
+		Types:       gameTypes,
+		PrimaryType: primaryType,
+		Domain: map[string]any{
+			"name":     "memo",
+			"version":  "1",
+			"chainId":  chainId,
+			"revision": "1",
+		},
+		Message: message,
+	}
+}
+
+// MoveCount is the number of signed moves accepted from the player
+func (p *Player) MoveCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.moves
+}
+
+// SessionKey is the public key of the current session, nil without one
+func (p *Player) SessionKey() *felt.Felt {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.session == nil {
+		return nil
+	}
+	return p.session.PublicKey
+}
+
+// MoveTypedData is the message signed for the index-th reveal of a player in a game
+func MoveTypedData(chainId *felt.Felt, gameId *felt.Felt, index int, x int, y int) *starknet.TypedData {
+	return gameTypedData(chainId, "Move", map[string]any{
+		"game_id": gameId,
+		"index":   index,
+		"x":       x,
+		"y":       y,
+	})
+}
+
+// verifySignature checks a [r, s] signature of td by account made with publicKey
+func verifySignature(td *starknet.TypedData, account *felt.Felt, publicKey *felt.Felt, signature []*felt.Felt, invalid error) error {
+	if len(signature) == 0 {
+		return ErrUnsignedMove
+	}
+	ok, err := td.Verify(account, publicKey, signature)
+	if err != nil {
+		return fmt.Errorf("%w: %w", invalid, err)
+	}
+	if !ok {
+		return invalid
+	}
+	return nil
+}
+
+// Verify checks the signature against the public key recorded with the move, or
+// against the session key and its authorization by that public key.
+func (m SignedMove) Verify() error {
+	publicKey := m.PublicKey
+	if m.Session != nil {
+		if err := m.Session.Verify(m.ChainId, m.Account, m.PublicKey); err != nil {
+			return err
+		}
+		if !m.Session.GameId.Equal(m.GameId) {
+			return ErrSessionGame
+		}
+		publicKey = m.Session.PublicKey
+	}
+	td := MoveTypedData(m.ChainId, m.GameId, m.Index, m.X, m.Y)
+	return verifySignature(td, m.Account, publicKey, m.Signature, ErrInvalidMoveSignature)
+}
+
+// verifyMove authenticates a reveal before it is applied, it returns nil for
+// anonymous players unless signed moves are required.
+func verifyMove(ua UserAction, board *Board, player *Player) (*SignedMove, error) {
+	if player == nil {
+		if RequireSignedMoves {
+			return nil, ErrUnsignedMove
+		}
+		return nil, nil
+	}
+	player.mu.Lock()
+	defer player.mu.Unlock()
+	if ua.Index != player.moves {
+		return nil, fmt.Errorf("%w: expected %d, got %d", ErrUnexpectedMoveIndex, player.moves, ua.Index)
+	}
+	move := &SignedMove{
+		GameId:    board.Commitment,
+		ChainId:   board.ChainId,
+		Account:   player.Account,
+		PublicKey: player.PublicKey,
+		Index:     ua.Index,
+		X:         ua.X,
+		Y:         ua.Y,
+		Signature: ua.Signature,
+	}
+	// moves signed by the session key are only valid while it is usable, the
+	// account key itself can always sign
+	if player.session != nil {
+		move.Session = player.session
+		if err := move.Verify(); err == nil {
+			if err := board.checkSession(player.session); err != nil {
+				return nil, err
+			}
+			player.moves++
+			return move, nil
+		}
+		move.Session = nil
+	}
+	if err := move.Verify(); err != nil {
+		return nil, err
+	}
+	player.moves++
+	return move, nil
+}
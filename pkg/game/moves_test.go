@@ -0,0 +1,189 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"golang.org/x/net/websocket"
+
+	"github.com/MartianGreed/memo-backend/pkg/signer"
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+)
+
+func signMove(t *testing.T, key *signer.Key, account *felt.Felt, b *Board, index int, x int, y int) []*felt.Felt {
+	t.Helper()
+	h, err := MoveTypedData(b.ChainId, b.Commitment, index, x, y).MessageHash(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := key.Sign(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []*felt.Felt{&sig.R, &sig.S}
+}
+
+// serverConn returns the server side of a websocket whose client discards every message
+func serverConn(t *testing.T) *websocket.Conn {
+	t.Helper()
+	conns := make(chan *websocket.Conn)
+	done := make(chan struct{})
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		conns <- ws
+		<-done
+	}))
+	client, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _, _ = io.Copy(io.Discard, client) }()
+	t.Cleanup(func() {
+		client.Close()
+		close(done)
+		srv.Close()
+	})
+	return <-conns
+}
+
+func TestHandleMessageVerifiesSignedMoves(t *testing.T) {
+	b, err := CreateBoard(testCollection(), Seed{Server: starknet.FeltFromInt(5)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.ChainId, _ = starknet.ChainId(starknet.Sepolia)
+	key, err := signer.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := starknet.FeltFromInt(0xacc)
+
+	ws := serverConn(t)
+	cp := NewConnectionPool()
+	cp.Connections[ws] = &ConnectionBuf{Name: "alice"}
+	cp.Players[ws] = UserHello{Account: account, PublicKey: key.PublicKey()}.player()
+
+	unsigned := UserAction{Event: "user.reveal-card", X: 1, Y: 2}
+	if err := HandleMessage(context.Background(), unsigned, b, ws, cp); !errors.Is(err, ErrUnsignedMove) {
+		t.Fatalf("expected ErrUnsignedMove, got %v", err)
+	}
+	forged := UserAction{Event: "user.reveal-card", X: 1, Y: 3, Signature: signMove(t, key, account, b, 0, 1, 2)}
+	if err := HandleMessage(context.Background(), forged, b, ws, cp); !errors.Is(err, ErrInvalidMoveSignature) {
+		t.Fatalf("expected ErrInvalidMoveSignature, got %v", err)
+	}
+
+	signed := UserAction{Event: "user.reveal-card", X: 1, Y: 2, Signature: signMove(t, key, account, b, 0, 1, 2)}
+	if err := HandleMessage(context.Background(), signed, b, ws, cp); err != nil {
+		t.Fatal(err)
+	}
+	// a replayed move carries a stale index
+	if err := HandleMessage(context.Background(), signed, b, ws, cp); !errors.Is(err, ErrUnexpectedMoveIndex) {
+		t.Fatalf("expected ErrUnexpectedMoveIndex, got %v", err)
+	}
+
+	moves := b.Moves()
+	if len(moves) != 1 || moves[0].X != 1 || moves[0].Y != 2 {
+		t.Fatalf("unexpected game record %+v", moves)
+	}
+	if err := moves[0].Verify(); err != nil {
+		t.Fatalf("recorded move does not verify: %v", err)
+	}
+}
+
+func TestRequireSignedMoves(t *testing.T) {
+	b, err := CreateBoard(testCollection(), Seed{Server: starknet.FeltFromInt(6)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	RequireSignedMoves = true
+	defer func() { RequireSignedMoves = false }()
+
+	if _, err := verifyMove(UserAction{Event: "user.reveal-card"}, b, nil); !errors.Is(err, ErrUnsignedMove) {
+		t.Fatalf("expected anonymous reveals to be rejected, got %v", err)
+	}
+}
+
+// run with -race, the api lists players while their moves are verified
+func TestPlayerReadsWhileVerifying(t *testing.T) {
+	b, err := CreateBoard(testCollection(), Seed{Server: starknet.FeltFromInt(10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.ChainId, _ = starknet.ChainId(starknet.Sepolia)
+	key, err := signer.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := starknet.FeltFromInt(0xacc)
+	player := UserHello{Account: account, PublicKey: key.PublicKey()}.player()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			ua := UserAction{Event: "user.reveal-card", Index: i, X: 0, Y: i, Signature: signMove(t, key, account, b, i, 0, i)}
+			if _, err := verifyMove(ua, b, player); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			if n := player.MoveCount(); n != 3 {
+				t.Fatalf("expected 3 moves, got %d", n)
+			}
+			return
+		default:
+			_ = player.MoveCount()
+			_ = player.SessionKey()
+		}
+	}
+}
+
+// accountKeys is a node where each account answers get_public_key with its key
+type accountKeys map[string]*felt.Felt
+
+func (a accountKeys) Call(ctx context.Context, address string, method string, params []felt.Felt) ([]felt.Felt, error) {
+	key, ok := a[address]
+	if !ok || method != "get_public_key" {
+		return nil, starknet.ErrContractNotFound
+	}
+	return []felt.Felt{*key}, nil
+}
+
+func TestHelloPlayerOwnsTheKey(t *testing.T) {
+	key, err := signer.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := signer.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := starknet.FeltFromInt(0xacc)
+	accounts := accountKeys{account.String(): key.PublicKey()}
+
+	player, err := UserHello{Account: account, PublicKey: key.PublicKey()}.Player(context.Background(), accounts)
+	if err != nil || player == nil || !player.Account.Equal(account) {
+		t.Fatalf("expected the account key to be accepted, got %v %v", player, err)
+	}
+
+	// a key pair of its own does not make a player the owner of the account
+	player, err = UserHello{Account: account, PublicKey: other.PublicKey()}.Player(context.Background(), accounts)
+	if !errors.Is(err, ErrAccountKeyMismatch) || player != nil {
+		t.Fatalf("expected ErrAccountKeyMismatch, got %v %v", player, err)
+	}
+	player, err = UserHello{Account: starknet.FeltFromInt(0xbad), PublicKey: key.PublicKey()}.Player(context.Background(), accounts)
+	if !errors.Is(err, starknet.ErrContractNotFound) || player != nil {
+		t.Fatalf("expected ErrContractNotFound, got %v %v", player, err)
+	}
+
+	if player, err := (UserHello{Name: "anon"}).Player(context.Background(), accounts); player != nil || err != nil {
+		t.Fatalf("expected an anonymous player, got %v %v", player, err)
+	}
+}
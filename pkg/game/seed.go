@@ -0,0 +1,45 @@
+package game
+
+import (
+	"math/rand/v2"
+
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+)
+
+// Seed holds every input used to lay out a board. The server seed is kept
+// secret until the game ends, only its commitment is published up front.
+type Seed struct {
+	Server    *felt.Felt `json:"server_seed"`
+	Client    *felt.Felt `json:"client_seed,omitempty"`
+	BlockHash *felt.Felt `json:"block_hash,omitempty"`
+}
+
+// Generate a new random server seed
+func NewServerSeed() (*felt.Felt, error) {
+	return new(felt.Felt).SetRandom()
+}
+
+// Commitment published to the players before the game starts
+func (s Seed) Commitment() *felt.Felt {
+	return crypto.PoseidonArray(s.Server)
+}
+
+// Derive mixes the server seed with the optional client seed and block hash
+func (s Seed) Derive() *felt.Felt {
+	return crypto.PoseidonArray(s.Server, orZero(s.Client), orZero(s.BlockHash))
+}
+
+// Rand returns a deterministic random stream for the derived seed
+func (s Seed) Rand() *rand.Rand {
+	return rand.New(rand.NewChaCha8(s.Derive().Bytes()))
+}
+
+func orZero(f *felt.Felt) *felt.Felt {
+	if f == nil {
+		return starknet.Zero
+	}
+	return f
+}
@@ -0,0 +1,98 @@
+package game
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/MartianGreed/memo-backend/pkg/data"
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+)
+
+func testCollection() *data.Collection {
+	var attrs []data.Attributes
+	for i := 1; i <= 50; i++ {
+		attrs = append(attrs, data.Attributes{Name: fmt.Sprintf("blobert #%d", i), TokenId: i})
+	}
+	return data.NewCollection(data.Blobert, attrs...)
+}
+
+func TestCreateBoardIsReproducible(t *testing.T) {
+	collection := testCollection()
+	seed := Seed{Server: starknet.FeltFromInt(42), Client: starknet.FeltFromInt(7)}
+
+	b1, err := CreateBoard(collection, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := CreateBoard(collection, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range b1.Layout() {
+		if !slices.Equal(b1.Layout()[i], b2.Layout()[i]) {
+			t.Fatalf("row %d differs: %v != %v", i, b1.Layout()[i], b2.Layout()[i])
+		}
+	}
+	for i := range b1.PublicKeys() {
+		if !b1.PublicKeys()[i].Equal(b2.PublicKeys()[i]) {
+			t.Fatalf("public key %d differs", i)
+		}
+	}
+	if !b1.Commitment.Equal(seed.Commitment()) {
+		t.Fatal("commitment does not match seed")
+	}
+
+	other, err := CreateBoard(collection, Seed{Server: starknet.FeltFromInt(42), Client: starknet.FeltFromInt(8)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.EqualFunc(b1.Layout(), other.Layout(), slices.Equal) {
+		t.Fatal("client seed did not change the layout")
+	}
+}
+
+func TestCreateBoardPlacesPairs(t *testing.T) {
+	b, err := CreateBoard(testCollection(), Seed{Server: starknet.FeltFromInt(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[int]int{}
+	for _, row := range b.Layout() {
+		for _, id := range row {
+			counts[id]++
+		}
+	}
+	if len(counts) != PairCount {
+		t.Fatalf("expected %d distinct tokens, got %d", PairCount, len(counts))
+	}
+	for id, n := range counts {
+		if n != 2 {
+			t.Fatalf("token %d placed %d times", id, n)
+		}
+	}
+}
+
+func TestRevealSeedRequiresFinishedGame(t *testing.T) {
+	seed := Seed{Server: starknet.FeltFromInt(3)}
+	b, err := CreateBoard(testCollection(), seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.RevealSeed(); err != ErrGameNotFinished {
+		t.Fatalf("expected ErrGameNotFinished, got %v", err)
+	}
+	for i := range b.Revealed {
+		for j := range b.Revealed[i] {
+			b.Revealed[i][j].Revealed = true
+		}
+	}
+	revealed, err := b.RevealSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revealed.Server.Equal(seed.Server) {
+		t.Fatal("revealed seed does not match")
+	}
+}
@@ -0,0 +1,142 @@
+package game
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"golang.org/x/net/websocket"
+
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+)
+
+var (
+	ErrAnonymousPlayer         = errors.New("player did not register an account")
+	ErrInvalidSessionSignature = errors.New("invalid session signature")
+	ErrSessionExpired          = errors.New("session expired")
+	ErrSessionRevoked          = errors.New("session revoked")
+	ErrSessionGame             = errors.New("session is for another game")
+	ErrNoSession               = errors.New("no session to revoke")
+)
+
+// now is replaced in tests
+var now = time.Now
+
+type (
+	// Session lets an ephemeral key sign the moves of an account in one game, so
+	// players do not have to approve every reveal in their wallet.
+	Session struct {
+		PublicKey *felt.Felt `json:"public_key"`
+		GameId    *felt.Felt `json:"game_id"`
+		// unix seconds
+		Expires int64 `json:"expires"`
+		// [r, s] signature of SessionTypedData by the account key
+		Signature []*felt.Felt `json:"signature"`
+	}
+	SystemSessionMessage struct {
+		Event     string
+		PublicKey *felt.Felt
+		Expires   int64
+	}
+)
+
+// SessionTypedData is the message an account signs to authorize a session key
+func SessionTypedData(chainId *felt.Felt, s Session) *starknet.TypedData {
+	return gameTypedData(chainId, "Session", map[string]any{
+		"session_key": s.PublicKey,
+		"game_id":     s.GameId,
+		"expires":     s.Expires,
+	})
+}
+
+// RevocationTypedData is signed by the account or the session key to end a session early
+func RevocationTypedData(chainId *felt.Felt, gameId *felt.Felt, sessionKey *felt.Felt) *starknet.TypedData {
+	return gameTypedData(chainId, "Revocation", map[string]any{
+		"session_key": sessionKey,
+		"game_id":     gameId,
+	})
+}
+
+// Verify checks the session was authorized by the account key
+func (s *Session) Verify(chainId *felt.Felt, account *felt.Felt, accountKey *felt.Felt) error {
+	if s.PublicKey == nil || s.GameId == nil {
+		return ErrInvalidSessionSignature
+	}
+	return verifySignature(SessionTypedData(chainId, *s), account, accountKey, s.Signature, ErrInvalidSessionSignature)
+}
+
+// checkSession enforces the expiry and revocation of a session
+func (b *Board) checkSession(s *Session) error {
+	if !s.GameId.Equal(b.Commitment) {
+		return ErrSessionGame
+	}
+	if now().Unix() >= s.Expires {
+		return ErrSessionExpired
+	}
+	b.record.mu.Lock()
+	defer b.record.mu.Unlock()
+	if _, ok := b.record.revoked[*s.PublicKey]; ok {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+func (b *Board) revokeSession(s *Session) {
+	b.record.mu.Lock()
+	defer b.record.mu.Unlock()
+	if b.record.revoked == nil {
+		b.record.revoked = map[felt.Felt]struct{}{}
+	}
+	b.record.revoked[*s.PublicKey] = struct{}{}
+}
+
+// authorizeSession replaces the session of player once its authorization is
+// checked, a revoked key can not be authorized again in the same game.
+func authorizeSession(ua UserAction, board *Board, player *Player) error {
+	if player == nil {
+		return ErrAnonymousPlayer
+	}
+	if ua.Session == nil {
+		return ErrInvalidSessionSignature
+	}
+	player.mu.Lock()
+	defer player.mu.Unlock()
+	if err := ua.Session.Verify(board.ChainId, player.Account, player.PublicKey); err != nil {
+		return err
+	}
+	if err := board.checkSession(ua.Session); err != nil {
+		return err
+	}
+	player.session = ua.Session
+	return nil
+}
+
+// revokeSession ends the session of player, the revocation is signed by either
+// the account or the session key.
+func revokeSession(ua UserAction, board *Board, player *Player) (*Session, error) {
+	if player == nil {
+		return nil, ErrAnonymousPlayer
+	}
+	player.mu.Lock()
+	defer player.mu.Unlock()
+	s := player.session
+	if s == nil {
+		return nil, ErrNoSession
+	}
+	td := RevocationTypedData(board.ChainId, s.GameId, s.PublicKey)
+	if err := verifySignature(td, player.Account, s.PublicKey, ua.Signature, ErrInvalidSessionSignature); err != nil {
+		if err := verifySignature(td, player.Account, player.PublicKey, ua.Signature, ErrInvalidSessionSignature); err != nil {
+			return nil, err
+		}
+	}
+	board.revokeSession(s)
+	player.session = nil
+	return s, nil
+}
+
+func sendSessionMessage(ws *websocket.Conn, event string, s *Session) {
+	if err := websocket.JSON.Send(ws, SystemSessionMessage{Event: event, PublicKey: s.PublicKey, Expires: s.Expires}); err != nil {
+		slog.Error("failed to send "+event, "error", err)
+	}
+}
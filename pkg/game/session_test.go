@@ -0,0 +1,124 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+
+	"github.com/MartianGreed/memo-backend/pkg/signer"
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+)
+
+func signTypedData(t *testing.T, key *signer.Key, account *felt.Felt, td *starknet.TypedData) []*felt.Felt {
+	t.Helper()
+	h, err := td.MessageHash(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := key.Sign(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []*felt.Felt{&sig.R, &sig.S}
+}
+
+func TestSessionKeys(t *testing.T) {
+	b, err := CreateBoard(testCollection(), Seed{Server: starknet.FeltFromInt(7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.ChainId, _ = starknet.ChainId(starknet.Sepolia)
+	accountKey, err := signer.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionKey, err := signer.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := starknet.FeltFromInt(0xacc)
+
+	start := time.Unix(1_700_000_000, 0)
+	now = func() time.Time { return start }
+	defer func() { now = time.Now }()
+
+	ws := serverConn(t)
+	cp := NewConnectionPool()
+	cp.Connections[ws] = &ConnectionBuf{Name: "alice"}
+	cp.Players[ws] = UserHello{Account: account, PublicKey: accountKey.PublicKey()}.player()
+
+	session := &Session{PublicKey: sessionKey.PublicKey(), GameId: b.Commitment, Expires: start.Add(time.Hour).Unix()}
+	forged := *session
+	forged.Signature = signTypedData(t, sessionKey, account, SessionTypedData(b.ChainId, *session))
+	if err := HandleMessage(context.Background(), UserAction{Event: "user.authorize-session", Session: &forged}, b, ws, cp); !errors.Is(err, ErrInvalidSessionSignature) {
+		t.Fatalf("expected a session not signed by the account to be rejected, got %v", err)
+	}
+
+	session.Signature = signTypedData(t, accountKey, account, SessionTypedData(b.ChainId, *session))
+	if err := HandleMessage(context.Background(), UserAction{Event: "user.authorize-session", Session: session}, b, ws, cp); err != nil {
+		t.Fatal(err)
+	}
+
+	move := func(index int, key *signer.Key) UserAction {
+		return UserAction{Event: "user.reveal-card", X: 0, Y: index, Index: index, Signature: signMove(t, key, account, b, index, 0, index)}
+	}
+	if err := HandleMessage(context.Background(), move(0, sessionKey), b, ws, cp); err != nil {
+		t.Fatal(err)
+	}
+	if err := HandleMessage(context.Background(), move(1, accountKey), b, ws, cp); err != nil {
+		t.Fatalf("the account key should still sign moves: %v", err)
+	}
+
+	moves := b.Moves()
+	if len(moves) != 2 || moves[0].Session == nil || moves[1].Session != nil {
+		t.Fatalf("unexpected game record %+v", moves)
+	}
+	for _, m := range moves {
+		if err := m.Verify(); err != nil {
+			t.Fatalf("move %d does not verify: %v", m.Index, err)
+		}
+	}
+
+	now = func() time.Time { return start.Add(2 * time.Hour) }
+	if err := HandleMessage(context.Background(), move(2, sessionKey), b, ws, cp); !errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("expected ErrSessionExpired, got %v", err)
+	}
+	now = func() time.Time { return start }
+
+	revoke := UserAction{Event: "user.revoke-session", Signature: signTypedData(t, sessionKey, account, RevocationTypedData(b.ChainId, b.Commitment, sessionKey.PublicKey()))}
+	if err := HandleMessage(context.Background(), revoke, b, ws, cp); err != nil {
+		t.Fatal(err)
+	}
+	if err := HandleMessage(context.Background(), move(2, sessionKey), b, ws, cp); !errors.Is(err, ErrInvalidMoveSignature) {
+		t.Fatalf("expected moves of a revoked session to be rejected, got %v", err)
+	}
+	if err := HandleMessage(context.Background(), UserAction{Event: "user.authorize-session", Session: session}, b, ws, cp); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("expected ErrSessionRevoked, got %v", err)
+	}
+}
+
+func TestSessionForAnotherGame(t *testing.T) {
+	b, err := CreateBoard(testCollection(), Seed{Server: starknet.FeltFromInt(8)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.ChainId, _ = starknet.ChainId(starknet.Mainnet)
+	key, err := signer.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := starknet.FeltFromInt(0xacc)
+	player := &Player{Account: account, PublicKey: key.PublicKey()}
+
+	session := &Session{PublicKey: starknet.FeltFromInt(1), GameId: starknet.FeltFromInt(9), Expires: time.Now().Add(time.Hour).Unix()}
+	session.Signature = signTypedData(t, key, account, SessionTypedData(b.ChainId, *session))
+	if err := authorizeSession(UserAction{Session: session}, b, player); !errors.Is(err, ErrSessionGame) {
+		t.Fatalf("expected ErrSessionGame, got %v", err)
+	}
+	if err := authorizeSession(UserAction{Session: session}, b, nil); !errors.Is(err, ErrAnonymousPlayer) {
+		t.Fatalf("expected ErrAnonymousPlayer, got %v", err)
+	}
+}
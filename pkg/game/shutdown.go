@@ -0,0 +1,85 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/websocket"
+
+	"github.com/MartianGreed/memo-backend/pkg/tracing"
+)
+
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// SystemShutdownMessage is the last message of every connection when the server stops
+type SystemShutdownMessage struct {
+	Event string
+	// milliseconds clients should wait before reconnecting
+	ReconnectAfter int64
+}
+
+func NewShutdownMessage(reconnectAfter time.Duration) SystemShutdownMessage {
+	return SystemShutdownMessage{Event: "system.server-shutdown", ReconnectAfter: reconnectAfter.Milliseconds()}
+}
+
+// track runs fn in the background unless the pool is shutting down, Shutdown
+// waits for tracked work before closing the connections
+func (cp *ConnectionPool) track(fn func()) {
+	cp.RLock()
+	defer cp.RUnlock()
+	if cp.closing {
+		return
+	}
+	cp.pending.Add(1)
+	go func() {
+		defer cp.pending.Done()
+		fn()
+	}()
+}
+
+// Shutdown lets pending reveals be hidden, sends msg to every connection and
+// closes them. Connections are closed even when ctx is done first, the error
+// is then the one of ctx.
+func (cp *ConnectionPool) Shutdown(ctx context.Context, msg SystemShutdownMessage) error {
+	cp.Lock()
+	cp.closing = true
+	cp.Unlock()
+
+	var err error
+	drained := make(chan struct{})
+	go func() {
+		cp.pending.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	cp.RLock()
+	connections := make([]*websocket.Conn, 0, len(cp.Connections))
+	for ws := range cp.Connections {
+		connections = append(connections, ws)
+	}
+	cp.RUnlock()
+
+	_, span := tracing.Tracer().Start(ctx, "game.shutdown", trace.WithAttributes(attribute.Int("game.connections", len(connections))))
+	defer func() { tracing.End(span, err) }()
+	deadline, hasDeadline := ctx.Deadline()
+	for _, ws := range connections {
+		// a stalled client must not hold the others
+		if hasDeadline {
+			_ = ws.SetWriteDeadline(deadline)
+		}
+		if sendErr := websocket.JSON.Send(ws, msg); sendErr != nil {
+			slog.Warn("failed to send "+msg.Event, "error", sendErr)
+		}
+		ws.Close()
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+)
+
+// listenedConn returns the server side of a websocket and the events its client receives
+func listenedConn(t *testing.T) (*websocket.Conn, <-chan map[string]any) {
+	t.Helper()
+	conns := make(chan *websocket.Conn)
+	done := make(chan struct{})
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		conns <- ws
+		<-done
+	}))
+	client, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan map[string]any, 16)
+	go func() {
+		defer close(received)
+		for {
+			var msg string
+			if err := websocket.Message.Receive(client, &msg); err != nil {
+				return
+			}
+			var event map[string]any
+			_ = json.Unmarshal([]byte(msg), &event)
+			received <- event
+		}
+	}()
+	t.Cleanup(func() {
+		client.Close()
+		close(done)
+		srv.Close()
+	})
+	return <-conns, received
+}
+
+func TestShutdownDrainsRevealsThenCloses(t *testing.T) {
+	b, err := CreateBoard(testCollection(), Seed{Server: starknet.FeltFromInt(8)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, received := listenedConn(t)
+	cp := NewConnectionPool()
+	if !cp.Join(ws, &ConnectionBuf{Name: "alice"}, nil) {
+		t.Fatal("expected to join an open pool")
+	}
+	if err := HandleMessage(context.Background(), UserAction{Event: "user.reveal-card", X: 0, Y: 0}, b, ws, cp); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), RevealTimeout+time.Second)
+	defer cancel()
+	if err := cp.Shutdown(ctx, NewShutdownMessage(3*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+	var last map[string]any
+	for event := range received {
+		events = append(events, event["Event"].(string))
+		last = event
+	}
+	if strings.Join(events, ",") != "system.reveal-card,system.hide-card,system.server-shutdown" {
+		t.Fatalf("expected the reveal to be hidden before the shutdown, got %v", events)
+	}
+	if last["ReconnectAfter"] != float64(3000) {
+		t.Fatalf("expected a reconnect hint in milliseconds, got %v", last["ReconnectAfter"])
+	}
+
+	if cp.Join(ws, &ConnectionBuf{Name: "bob"}, nil) {
+		t.Fatal("expected a draining pool to refuse connections")
+	}
+	if err := HandleMessage(context.Background(), UserAction{Event: "user.hover-card"}, b, ws, cp); !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("expected ErrShuttingDown, got %v", err)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	ws, received := listenedConn(t)
+	cp := NewConnectionPool()
+	cp.Join(ws, &ConnectionBuf{Name: "alice"}, nil)
+	// a reveal that is never hidden in time
+	stuck := make(chan struct{})
+	defer close(stuck)
+	cp.track(func() { <-stuck })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := cp.Shutdown(ctx, NewShutdownMessage(time.Second)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to be reported, got %v", err)
+	}
+	// connections are closed anyway
+	for range received {
+	}
+}
@@ -0,0 +1,56 @@
+package indexer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/NethermindEth/juno/core/felt"
+
+	"github.com/MartianGreed/memo-backend/internal/fsutil"
+)
+
+// BlockRef is a block the indexer has processed
+type BlockRef struct {
+	Number uint64     `json:"number"`
+	Hash   *felt.Felt `json:"hash"`
+}
+
+// Checkpoint is the indexer progress, every block up to Block has been delivered
+type Checkpoint struct {
+	Contract *felt.Felt `json:"contract"`
+	Block    uint64     `json:"block"`
+	// Last processed ranges, newest last, walked back to find the common ancestor on reorgs
+	Recent []BlockRef `json:"recent"`
+}
+
+func (c *Checkpoint) empty() bool {
+	return len(c.Recent) == 0
+}
+
+// loadCheckpoint returns an empty checkpoint when path does not exist
+func loadCheckpoint(path string) (*Checkpoint, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Checkpoint{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c Checkpoint
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (c *Checkpoint) save(path string) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return fsutil.WriteAtomic(path, b)
+}
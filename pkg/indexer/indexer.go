@@ -0,0 +1,315 @@
+package indexer
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+)
+
+// Reorg is the name of the event sent to every subscriber when blocks were
+// replaced, its BlockNumber is the first block whose events must be discarded.
+// Events of the new blocks are delivered again afterwards.
+const Reorg = "reorg"
+
+// Events emitted by the game contract
+var GameEvents = []string{"Spawn", "Join", "MatchTiles"}
+
+var (
+	ErrReorgTooDeep     = errors.New("reorg deeper than the checkpoint history")
+	ErrContractMismatch = errors.New("checkpoint belongs to another contract")
+)
+
+// Client is the subset of the rpc client used by the indexer
+type Client interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	GetBlockWithTxHashes(ctx context.Context, blockId starknet.BlockId) (*starknet.BlockWithTxHashes, error)
+	GetEvents(ctx context.Context, filter starknet.EventFilter) (*starknet.EventsChunk, error)
+}
+
+// Event is a contract event along with the name it was registered under
+type Event struct {
+	Name string
+	starknet.EmittedEvent
+}
+
+type subscription struct {
+	names map[string]bool
+	ch    chan Event
+	fn    func(Event)
+	done  chan struct{}
+}
+
+func (s *subscription) wants(name string) bool {
+	return name == Reorg || len(s.names) == 0 || s.names[name]
+}
+
+type Indexer struct {
+	Client   Client
+	Contract *felt.Felt
+	// Progress is persisted to this file after every processed range
+	CheckpointFile string
+	// First block to index when there is no checkpoint
+	StartBlock uint64
+	// Blocks this far behind the head are considered final enough to be indexed
+	Confirmations uint64
+	BlockRange    uint64
+	ChunkSize     int
+	PollInterval  time.Duration
+	// Number of processed ranges kept to find the common ancestor on reorgs
+	History int
+
+	selectors map[felt.Felt]string
+	mu        sync.Mutex
+	subs      map[int]*subscription
+	nextSub   int
+}
+
+func NewIndexer(client Client, contract *felt.Felt, checkpointFile string, events ...string) (*Indexer, error) {
+	selectors := make(map[felt.Felt]string, len(events))
+	for _, name := range events {
+		selector, err := starknet.StarknetKeccak([]byte(name))
+		if err != nil {
+			return nil, err
+		}
+		selectors[*selector] = name
+	}
+	return &Indexer{
+		Client:         client,
+		Contract:       contract,
+		CheckpointFile: checkpointFile,
+		BlockRange:     1000,
+		ChunkSize:      100,
+		PollInterval:   10 * time.Second,
+		History:        64,
+		selectors:      selectors,
+		subs:           make(map[int]*subscription),
+	}, nil
+}
+
+// Subscribe returns a channel receiving the named events, all of them when no
+// name is given. Delivery blocks the indexer so events are never dropped,
+// call unsubscribe once the channel is no longer read.
+//
+// Delivery is at least once: events are published before the checkpoint is
+// saved, so a range interrupted by a failure or a restart is delivered again.
+// Subscribers must be idempotent, or key events by transaction hash.
+func (ix *Indexer) Subscribe(buffer int, names ...string) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	return ch, ix.subscribe(&subscription{ch: ch}, names)
+}
+
+// Handle calls fn from the indexer goroutine for every named event
+func (ix *Indexer) Handle(fn func(Event), names ...string) func() {
+	return ix.subscribe(&subscription{fn: fn}, names)
+}
+
+func (ix *Indexer) subscribe(s *subscription, names []string) func() {
+	s.done = make(chan struct{})
+	s.names = make(map[string]bool, len(names))
+	for _, name := range names {
+		s.names[name] = true
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	id := ix.nextSub
+	ix.nextSub++
+	ix.subs[id] = s
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ix.mu.Lock()
+			delete(ix.subs, id)
+			ix.mu.Unlock()
+			close(s.done)
+		})
+	}
+}
+
+func (ix *Indexer) publish(ctx context.Context, ev Event) error {
+	ix.mu.Lock()
+	subs := make([]*subscription, 0, len(ix.subs))
+	for _, s := range ix.subs {
+		if s.wants(ev.Name) {
+			subs = append(subs, s)
+		}
+	}
+	ix.mu.Unlock()
+
+	for _, s := range subs {
+		if s.fn != nil {
+			s.fn(ev)
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		case <-s.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Run indexes the contract until ctx is done, transient rpc failures are
+// retried every PollInterval.
+func (ix *Indexer) Run(ctx context.Context) error {
+	cp, err := loadCheckpoint(ix.CheckpointFile)
+	if err != nil {
+		return err
+	}
+	if cp.Contract != nil && !cp.Contract.Equal(ix.Contract) {
+		return errors.Wrapf(ErrContractMismatch, "%s indexes %s", ix.CheckpointFile, cp.Contract)
+	}
+	cp.Contract = ix.Contract
+
+	for {
+		caughtUp, err := ix.step(ctx, cp)
+		if errors.Is(err, ErrReorgTooDeep) || errors.Is(err, ErrContractMismatch) || ctx.Err() != nil {
+			return err
+		}
+		if err != nil {
+			slog.Warn("indexer step failed", "contract", ix.Contract.String(), "error", err)
+		}
+		if !caughtUp && err == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(ix.PollInterval):
+		}
+	}
+}
+
+// step handles reorgs then indexes the next block range, it reports whether
+// the indexer reached the head of the chain.
+func (ix *Indexer) step(ctx context.Context, cp *Checkpoint) (bool, error) {
+	if err := ix.checkReorg(ctx, cp); err != nil {
+		return false, err
+	}
+
+	head, err := ix.Client.BlockNumber(ctx)
+	if err != nil {
+		return false, err
+	}
+	if head < ix.Confirmations {
+		return true, nil
+	}
+	safeHead := head - ix.Confirmations
+
+	from := ix.StartBlock
+	if !cp.empty() {
+		from = cp.Block + 1
+	}
+	if from > safeHead {
+		return true, nil
+	}
+	to := min(safeHead, from+max(ix.BlockRange, 1)-1)
+
+	// the range ends at the hash of its last block, if that block is replaced
+	// while the events are fetched they may come from the old chain, the range
+	// is then discarded and delivered again
+	block, err := ix.Client.GetBlockWithTxHashes(ctx, starknet.BlockNumberId(to))
+	if err != nil {
+		return false, err
+	}
+	if block.BlockHash == nil {
+		return false, errors.Newf("block %d has no hash yet", to)
+	}
+	// a pinned block that disappeared also fails the events request
+	indexErr := ix.index(ctx, from, starknet.BlockHashId(block.BlockHash))
+	after, err := ix.Client.GetBlockWithTxHashes(ctx, starknet.BlockNumberId(to))
+	if err != nil && !errors.Is(err, starknet.ErrBlockNotFound) {
+		return false, errors.CombineErrors(indexErr, err)
+	}
+	if err != nil || !block.BlockHash.Equal(after.BlockHash) {
+		slog.Warn("chain reorganization while indexing", "contract", ix.Contract.String(), "from", from, "to", to)
+		return false, ix.publish(ctx, Event{Name: Reorg, EmittedEvent: starknet.EmittedEvent{BlockNumber: from}})
+	}
+	if indexErr != nil {
+		return false, indexErr
+	}
+
+	cp.Block = to
+	cp.Recent = append(cp.Recent, BlockRef{Number: to, Hash: block.BlockHash})
+	if len(cp.Recent) > max(ix.History, 1) {
+		cp.Recent = cp.Recent[len(cp.Recent)-max(ix.History, 1):]
+	}
+	if err := cp.save(ix.CheckpointFile); err != nil {
+		return false, err
+	}
+	slog.Debug("indexed blocks", "contract", ix.Contract.String(), "from", from, "to", to)
+	return to == safeHead, nil
+}
+
+// index delivers the events of [from, to], following continuation tokens
+func (ix *Indexer) index(ctx context.Context, from uint64, to starknet.BlockId) error {
+	keys := make([]*felt.Felt, 0, len(ix.selectors))
+	for selector := range ix.selectors {
+		keys = append(keys, &selector)
+	}
+	filter := starknet.EventFilter{
+		FromBlock: starknet.BlockNumberId(from),
+		ToBlock:   to,
+		Address:   ix.Contract,
+		Keys:      [][]*felt.Felt{keys},
+		ChunkSize: ix.ChunkSize,
+	}
+	for {
+		chunk, err := ix.Client.GetEvents(ctx, filter)
+		if err != nil {
+			return err
+		}
+		for _, ev := range chunk.Events {
+			if len(ev.Keys) == 0 {
+				continue
+			}
+			name, ok := ix.selectors[*ev.Keys[0]]
+			if !ok {
+				continue
+			}
+			if err := ix.publish(ctx, Event{Name: name, EmittedEvent: ev}); err != nil {
+				return err
+			}
+		}
+		if chunk.ContinuationToken == "" {
+			return nil
+		}
+		filter.ContinuationToken = chunk.ContinuationToken
+	}
+}
+
+// checkReorg compares the last processed block with the chain and rewinds the
+// checkpoint to the newest block both agree on.
+func (ix *Indexer) checkReorg(ctx context.Context, cp *Checkpoint) error {
+	for i := len(cp.Recent) - 1; i >= 0; i-- {
+		ref := cp.Recent[i]
+		block, err := ix.Client.GetBlockWithTxHashes(ctx, starknet.BlockNumberId(ref.Number))
+		if err != nil && !errors.Is(err, starknet.ErrBlockNotFound) {
+			return err
+		}
+		if err == nil && block.BlockHash != nil && block.BlockHash.Equal(ref.Hash) {
+			if i == len(cp.Recent)-1 {
+				return nil
+			}
+			slog.Warn("chain reorganization", "contract", ix.Contract.String(), "from", ref.Number+1, "depth", cp.Block-ref.Number)
+			cp.Block = ref.Number
+			cp.Recent = cp.Recent[:i+1]
+			if err := cp.save(ix.CheckpointFile); err != nil {
+				return err
+			}
+			return ix.publish(ctx, Event{Name: Reorg, EmittedEvent: starknet.EmittedEvent{BlockNumber: ref.Number + 1}})
+		}
+	}
+	if len(cp.Recent) == 0 {
+		return nil
+	}
+	return errors.Wrapf(ErrReorgTooDeep, "no common ancestor since block %d", cp.Recent[0].Number)
+}
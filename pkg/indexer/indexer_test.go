@@ -0,0 +1,211 @@
+package indexer
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// fakeChain serves blocks and events from memory, events are paged by ChunkSize
+type fakeChain struct {
+	sync.Mutex
+	hashes []*felt.Felt
+	events map[uint64][]starknet.EmittedEvent
+	// called with the chain locked after every events chunk
+	afterEvents func()
+}
+
+func newFakeChain(blocks int) *fakeChain {
+	c := &fakeChain{events: make(map[uint64][]starknet.EmittedEvent)}
+	for i := 0; i < blocks; i++ {
+		c.hashes = append(c.hashes, starknet.FeltFromInt(1000+i))
+	}
+	return c
+}
+
+func (c *fakeChain) emit(t *testing.T, block uint64, name string, data int) {
+	t.Helper()
+	selector, err := starknet.StarknetKeccak([]byte(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.events[block] = append(c.events[block], starknet.EmittedEvent{
+		Event:       starknet.Event{Keys: []*felt.Felt{selector}, Data: []*felt.Felt{starknet.FeltFromInt(data)}},
+		BlockHash:   c.hashes[block],
+		BlockNumber: block,
+	})
+}
+
+func (c *fakeChain) BlockNumber(ctx context.Context) (uint64, error) {
+	c.Lock()
+	defer c.Unlock()
+	return uint64(len(c.hashes) - 1), nil
+}
+
+func (c *fakeChain) GetBlockWithTxHashes(ctx context.Context, blockId starknet.BlockId) (*starknet.BlockWithTxHashes, error) {
+	c.Lock()
+	defer c.Unlock()
+	n, err := strconv.ParseUint(string(blockId), 10, 64)
+	if err != nil || n >= uint64(len(c.hashes)) {
+		return nil, starknet.ErrBlockNotFound
+	}
+	return &starknet.BlockWithTxHashes{BlockHeader: starknet.BlockHeader{BlockNumber: n, BlockHash: c.hashes[n]}}, nil
+}
+
+func (c *fakeChain) GetEvents(ctx context.Context, filter starknet.EventFilter) (*starknet.EventsChunk, error) {
+	c.Lock()
+	defer c.Unlock()
+	from, _ := strconv.ParseUint(string(filter.FromBlock), 10, 64)
+	to, ok := filter.ToBlock.Number()
+	if hash, isHash := filter.ToBlock.Hash(); isHash {
+		for n, h := range c.hashes {
+			if h.Equal(hash) {
+				to, ok = uint64(n), true
+			}
+		}
+	}
+	if !ok {
+		return nil, starknet.ErrBlockNotFound
+	}
+	if c.afterEvents != nil {
+		defer c.afterEvents()
+	}
+	var all []starknet.EmittedEvent
+	for n := from; n <= to; n++ {
+		all = append(all, c.events[n]...)
+	}
+	offset, _ := strconv.Atoi(filter.ContinuationToken)
+	end := min(offset+filter.ChunkSize, len(all))
+	chunk := &starknet.EventsChunk{Events: all[offset:end]}
+	if end < len(all) {
+		chunk.ContinuationToken = strconv.Itoa(end)
+	}
+	return chunk, nil
+}
+
+func newTestIndexer(t *testing.T, chain *fakeChain, file string) *Indexer {
+	t.Helper()
+	ix, err := NewIndexer(chain, starknet.FeltFromInt(0x539), file, GameEvents...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix.BlockRange = 4
+	ix.ChunkSize = 1
+	return ix
+}
+
+// drain steps the indexer until it reaches the head and returns what was delivered
+func drain(t *testing.T, ix *Indexer, cp *Checkpoint) []Event {
+	t.Helper()
+	var got []Event
+	unsubscribe := ix.Handle(func(ev Event) { got = append(got, ev) })
+	defer unsubscribe()
+	for i := 0; i < 100; i++ {
+		caughtUp, err := ix.step(context.Background(), cp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if caughtUp {
+			return got
+		}
+	}
+	t.Fatal("indexer never caught up")
+	return nil
+}
+
+func TestIndexerDeliversEventsAndResumes(t *testing.T) {
+	chain := newFakeChain(10)
+	chain.emit(t, 1, "Spawn", 1)
+	chain.emit(t, 5, "Join", 2)
+	chain.emit(t, 5, "Unrelated", 3)
+	chain.emit(t, 9, "MatchTiles", 4)
+	file := filepath.Join(t.TempDir(), "indexer.json")
+
+	ix := newTestIndexer(t, chain, file)
+	events, unsubscribe := ix.Subscribe(10, "Join", "MatchTiles")
+	defer unsubscribe()
+	got := drain(t, ix, &Checkpoint{})
+
+	if len(got) != 3 || got[0].Name != "Spawn" || got[1].Name != "Join" || got[2].Name != "MatchTiles" {
+		t.Fatalf("unexpected events %v", got)
+	}
+	if len(events) != 2 || (<-events).Name != "Join" {
+		t.Fatal("subscription did not filter events")
+	}
+
+	cp, err := loadCheckpoint(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Block != 9 || !cp.Recent[len(cp.Recent)-1].Hash.Equal(chain.hashes[9]) {
+		t.Fatalf("unexpected checkpoint %+v", cp)
+	}
+
+	chain.hashes = append(chain.hashes, starknet.FeltFromInt(2000))
+	chain.emit(t, 10, "Join", 5)
+	got = drain(t, newTestIndexer(t, chain, file), cp)
+	if len(got) != 1 || got[0].BlockNumber != 10 {
+		t.Fatalf("expected only the new event, got %v", got)
+	}
+}
+
+func TestIndexerRewindsOnReorg(t *testing.T) {
+	chain := newFakeChain(10)
+	chain.emit(t, 9, "Join", 1)
+	ix := newTestIndexer(t, chain, filepath.Join(t.TempDir(), "indexer.json"))
+	cp := &Checkpoint{}
+	drain(t, ix, cp)
+
+	// blocks 9 and up are replaced, the join moved to block 10
+	chain.hashes[9] = starknet.FeltFromInt(3000)
+	chain.hashes = append(chain.hashes, starknet.FeltFromInt(3001))
+	chain.events[9] = nil
+	chain.emit(t, 10, "Join", 1)
+
+	// the previous processed range ended at block 7
+	got := drain(t, ix, cp)
+	if len(got) != 2 || got[0].Name != Reorg || got[0].BlockNumber != 8 || got[1].BlockNumber != 10 {
+		t.Fatalf("unexpected events %v", got)
+	}
+	if cp.Block != 10 {
+		t.Fatalf("expected checkpoint at 10, got %d", cp.Block)
+	}
+}
+
+func TestIndexerRedeliversRangeReorgedWhileIndexing(t *testing.T) {
+	chain := newFakeChain(4)
+	chain.emit(t, 3, "Join", 1)
+	ix := newTestIndexer(t, chain, filepath.Join(t.TempDir(), "indexer.json"))
+	// block 3 is replaced once its events were fetched
+	chain.afterEvents = func() {
+		chain.hashes[3] = starknet.FeltFromInt(3000)
+		chain.events[3] = nil
+		chain.afterEvents = nil
+	}
+	chain.emit(t, 2, "Join", 2)
+
+	cp := &Checkpoint{}
+	got := drain(t, ix, cp)
+	if len(got) != 3 || got[1].Name != Reorg || got[1].BlockNumber != 0 || got[2].BlockNumber != 2 {
+		t.Fatalf("expected the range to be discarded and delivered again, got %v", got)
+	}
+	if !cp.Recent[len(cp.Recent)-1].Hash.Equal(chain.hashes[3]) {
+		t.Fatal("expected the checkpoint to keep the hash of the new chain")
+	}
+}
+
+func TestIndexerRejectsOtherContractCheckpoint(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "indexer.json")
+	if err := (&Checkpoint{Contract: starknet.FeltFromInt(1), Block: 3}).save(file); err != nil {
+		t.Fatal(err)
+	}
+	ix := newTestIndexer(t, newFakeChain(1), file)
+	if err := ix.Run(context.Background()); err == nil {
+		t.Fatal("expected contract mismatch")
+	}
+}
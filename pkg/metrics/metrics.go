@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "memo"
+
+var (
+	WsConnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_connects_total",
+		Help:      "Websocket connections accepted.",
+	})
+	WsDisconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_disconnects_total",
+		Help:      "Websocket connections closed.",
+	})
+	Messages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_total",
+		Help:      "Messages received from players by event type.",
+	}, []string{"event"})
+	Broadcast = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "broadcast_duration_seconds",
+		Help:      "Time to send a message to every connection of a room.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"event"})
+	RevealToHide = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reveal_to_hide_seconds",
+		Help:      "Time a revealed card stays visible before it is hidden again.",
+		Buckets:   []float64{1, 1.5, 1.8, 2, 2.5, 3, 5},
+	})
+	Matches = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "matches_total",
+		Help:      "Pairs matched in every game.",
+	})
+	MatchesPerGame = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "matches_per_game",
+		Help:      "Pairs matched in a game, observed when it finishes or when its room is shut down.",
+		Buckets:   prometheus.LinearBuckets(0, 5, 7),
+	})
+	RpcCalls = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_call_duration_seconds",
+		Help:      "Starknet JSON-RPC calls by method and status, every endpoint attempt is observed.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "status"})
+	RpcBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_batch_size",
+		Help:      "Calls sent in a Starknet JSON-RPC batch, batches are observed by rpc_call_duration_seconds under the batch method.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 8),
+	})
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Collection metadata cache lookups by result, hit, stale or miss.",
+	}, []string{"result"})
+)
+
+// events counted under their own label, anything else is counted as unknown so
+// clients can not blow up the label cardinality
+var knownEvents = map[string]bool{
+	"user.hover-card":        true,
+	"user.leave-card":        true,
+	"user.reveal-card":       true,
+	"user.authorize-session": true,
+	"user.revoke-session":    true,
+}
+
+// Message counts a message received from a player
+func Message(event string) {
+	if !knownEvents[event] {
+		event = "unknown"
+	}
+	Messages.WithLabelValues(event).Inc()
+}
+
+// Handler serves the default registry
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
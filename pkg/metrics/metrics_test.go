@@ -0,0 +1,23 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMessageBucketsUnknownEvents(t *testing.T) {
+	Message("user.reveal-card")
+	Message("user.whatever")
+	Message("user.something-else")
+
+	if n := testutil.ToFloat64(Messages.WithLabelValues("unknown")); n != 2 {
+		t.Fatalf("expected 2 unknown messages, got %v", n)
+	}
+	if n := testutil.ToFloat64(Messages.WithLabelValues("user.reveal-card")); n != 1 {
+		t.Fatalf("expected 1 reveal, got %v", n)
+	}
+	if n := testutil.CollectAndCount(Messages); n != 2 {
+		t.Fatalf("expected 2 series, got %d", n)
+	}
+}
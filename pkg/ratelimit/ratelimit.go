@@ -0,0 +1,222 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limit of an endpoint, zero values mean unlimited
+type Limit struct {
+	// Requests per minute
+	RPM   int
+	Burst int
+	// Requests in flight at the same time
+	Concurrency int
+}
+
+// LimitFromEnv reads <prefix>_RPM, <prefix>_BURST and <prefix>_CONCURRENCY, keeping def for unset values
+func LimitFromEnv(prefix string, def Limit) Limit {
+	read := func(name string, v int) int {
+		if n, err := strconv.Atoi(os.Getenv(prefix + "_" + name)); err == nil && n >= 0 {
+			return n
+		}
+		return v
+	}
+	return Limit{
+		RPM:         read("RPM", def.RPM),
+		Burst:       read("BURST", def.Burst),
+		Concurrency: read("CONCURRENCY", def.Concurrency),
+	}
+}
+
+// Stats about the time spent waiting for the limiter
+type Stats struct {
+	Requests  uint64
+	Throttled uint64
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+// Limiter combines a token bucket with a cap on concurrent requests
+type Limiter struct {
+	bucket *rate.Limiter
+	slots  chan struct{}
+	stats  Stats
+	mu     sync.Mutex
+}
+
+func NewLimiter(l Limit) *Limiter {
+	limiter := &Limiter{bucket: rate.NewLimiter(rate.Inf, 0)}
+	if l.RPM > 0 {
+		limiter.bucket = rate.NewLimiter(rate.Limit(float64(l.RPM)/60), max(l.Burst, 1))
+	}
+	if l.Concurrency > 0 {
+		limiter.slots = make(chan struct{}, l.Concurrency)
+	}
+	return limiter
+}
+
+// Acquire blocks until a request may be sent. release must be called once the request is done.
+func (l *Limiter) Acquire(ctx context.Context) (release func(), err error) {
+	start := time.Now()
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if err := l.bucket.Wait(ctx); err != nil {
+		l.free()
+		return nil, err
+	}
+	l.record(time.Since(start))
+
+	var once sync.Once
+	return func() { once.Do(l.free) }, nil
+}
+
+// TryAcquire is Acquire without waiting, ok is false when a request may not be sent right now
+func (l *Limiter) TryAcquire() (release func(), ok bool) {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			return nil, false
+		}
+	}
+	if !l.bucket.Allow() {
+		l.free()
+		return nil, false
+	}
+	l.record(0)
+
+	var once sync.Once
+	return func() { once.Do(l.free) }, true
+}
+
+func (l *Limiter) free() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+func (l *Limiter) record(wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats.Requests++
+	// anything under a millisecond is scheduling noise
+	if wait >= time.Millisecond {
+		l.stats.Throttled++
+		l.stats.TotalWait += wait
+		l.stats.MaxWait = max(l.stats.MaxWait, wait)
+	}
+}
+
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// Transport rate limits outgoing requests per host, wrap any http.Client with it
+type Transport struct {
+	Base    http.RoundTripper
+	Default Limit
+	// Limits by host, hosts not listed get Default
+	Limits map[string]Limit
+
+	limiters map[string]*Limiter
+	mu       sync.Mutex
+}
+
+func NewTransport(base http.RoundTripper, def Limit, limits map[string]Limit) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Base: base, Default: def, Limits: limits, limiters: make(map[string]*Limiter)}
+}
+
+// Wrap returns a copy of client sending its requests through t
+func (t *Transport) Wrap(client *http.Client) *http.Client {
+	wrapped := *client
+	if client.Transport == nil {
+		wrapped.Transport = t
+	} else {
+		// keep the client's own transport but share the limiters of t
+		wrapped.Transport = &sharedTransport{Transport: t, base: client.Transport}
+	}
+	return &wrapped
+}
+
+func (t *Transport) limiter(host string) *Limiter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if l, ok := t.limiters[host]; ok {
+		return l
+	}
+	limit, ok := t.Limits[host]
+	if !ok {
+		limit = t.Default
+	}
+	l := NewLimiter(limit)
+	t.limiters[host] = l
+	return l
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.roundTrip(t.Base, req)
+}
+
+func (t *Transport) roundTrip(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	release, err := t.limiter(req.URL.Host).Acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	// the request is in flight until its body has been consumed
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// Stats by host
+func (t *Transport) Stats() map[string]Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := make(map[string]Stats, len(t.limiters))
+	for host, l := range t.limiters {
+		stats[host] = l.Stats()
+	}
+	return stats
+}
+
+type sharedTransport struct {
+	*Transport
+	base http.RoundTripper
+}
+
+func (t *sharedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.roundTrip(t.base, req)
+}
+
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiterCapsConcurrency(t *testing.T) {
+	l := NewLimiter(Limit{Concurrency: 2})
+	var inFlight, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.Acquire(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer release()
+			n := inFlight.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			inFlight.Add(-1)
+		}()
+	}
+	wg.Wait()
+	if peak.Load() > 2 {
+		t.Fatalf("expected at most 2 requests in flight, got %d", peak.Load())
+	}
+	if l.Stats().Requests != 10 {
+		t.Fatalf("unexpected stats %+v", l.Stats())
+	}
+}
+
+func TestLimiterTokenBucket(t *testing.T) {
+	// one request every 10ms after the first
+	l := NewLimiter(Limit{RPM: 6000, Burst: 1})
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		release, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if elapsed := time.Since(start); elapsed < 25*time.Millisecond {
+		t.Fatalf("requests were not throttled, took %s", elapsed)
+	}
+	if stats := l.Stats(); stats.Throttled == 0 || stats.TotalWait == 0 || stats.MaxWait == 0 {
+		t.Fatalf("wait time was not recorded %+v", stats)
+	}
+}
+
+func TestLimiterHonoursContext(t *testing.T) {
+	l := NewLimiter(Limit{Concurrency: 1})
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestLimiterTryAcquire(t *testing.T) {
+	l := NewLimiter(Limit{RPM: 1, Burst: 2, Concurrency: 1})
+	release, ok := l.TryAcquire()
+	if !ok {
+		t.Fatal("expected the first request to be let in")
+	}
+	if _, ok := l.TryAcquire(); ok {
+		t.Fatal("expected the concurrency cap to refuse a second request")
+	}
+	release()
+	release, ok = l.TryAcquire()
+	if !ok {
+		t.Fatal("expected the burst to let a second request in")
+	}
+	release()
+	if _, ok := l.TryAcquire(); ok {
+		t.Fatal("expected an empty bucket to refuse the request")
+	}
+	if stats := l.Stats(); stats.Requests != 2 || stats.Throttled != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestTransportLimitsPerHost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	host := mustHost(t, srv.URL)
+
+	transport := NewTransport(nil, Limit{}, map[string]Limit{host: {Concurrency: 1}})
+	client := transport.Wrap(&http.Client{})
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the slot is held until the body is closed
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("second request should wait for the first body to be closed")
+	}
+	_, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	resp, err = client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if stats := transport.Stats()[host]; stats.Requests != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func mustHost(t *testing.T, raw string) string {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
@@ -0,0 +1,87 @@
+package signer
+
+import (
+	"crypto/rand"
+	"math/big"
+
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+	starkcurve "github.com/consensys/gnark-crypto/ecc/stark-curve"
+	"github.com/consensys/gnark-crypto/ecc/stark-curve/ecdsa"
+	"github.com/consensys/gnark-crypto/ecc/stark-curve/fr"
+)
+
+var ErrInvalidKey = errors.New("invalid stark private key")
+
+// Key is a private key on the Stark curve
+type Key struct {
+	inner *ecdsa.PrivateKey
+	// scalar, big endian
+	scalar [32]byte
+}
+
+func GenerateKey() (*Key, error) {
+	inner, err := ecdsa.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	// the scalar sits after the compressed public key
+	b := inner.Bytes()
+	return KeyFromBytes(b[len(b)-fr.Bytes:])
+}
+
+// KeyFromBytes reads a big endian scalar in [1, curve order)
+func KeyFromBytes(b []byte) (*Key, error) {
+	k := new(big.Int).SetBytes(b)
+	if len(b) > 32 || k.Sign() == 0 || k.Cmp(fr.Modulus()) >= 0 {
+		return nil, ErrInvalidKey
+	}
+
+	var pub starkcurve.G1Affine
+	_, g := starkcurve.Generators()
+	pub.ScalarMultiplication(&g, k)
+
+	key := &Key{inner: new(ecdsa.PrivateKey)}
+	k.FillBytes(key.scalar[:])
+	pubBytes := pub.Bytes()
+	if _, err := key.inner.SetBytes(append(pubBytes[:], key.scalar[:]...)); err != nil {
+		return nil, errors.Mark(err, ErrInvalidKey)
+	}
+	return key, nil
+}
+
+func KeyFromFelt(f *felt.Felt) (*Key, error) {
+	b := f.Bytes()
+	return KeyFromBytes(b[:])
+}
+
+// PrivateKey returns the secret scalar, handle with care
+func (k *Key) PrivateKey() *felt.Felt {
+	return new(felt.Felt).SetBytes(k.scalar[:])
+}
+
+// PublicKey is the x coordinate of the public point, as used by Starknet accounts
+func (k *Key) PublicKey() *felt.Felt {
+	return felt.NewFelt(&k.inner.PublicKey.A.X)
+}
+
+// Sign signs a message hash, it must be a felt such as a transaction or typed data hash
+func (k *Key) Sign(msgHash *felt.Felt) (*crypto.Signature, error) {
+	msg := msgHash.Bytes()
+	b, err := k.inner.Sign(msg[:], nil)
+	if err != nil {
+		return nil, err
+	}
+	var sig crypto.Signature
+	sig.R.SetBytes(b[:fr.Bytes])
+	sig.S.SetBytes(b[fr.Bytes:])
+	return &sig, nil
+}
+
+// Verify checks sig against a public key given as its x coordinate
+func Verify(publicKey *felt.Felt, msgHash *felt.Felt, sig *crypto.Signature) bool {
+	pub := crypto.NewPublicKey(publicKey)
+	ok, err := pub.Verify(sig, msgHash)
+	return err == nil && ok
+}
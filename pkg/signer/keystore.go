@@ -0,0 +1,219 @@
+package signer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/cockroachdb/errors"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/sha3"
+)
+
+var (
+	ErrWrongPassphrase     = errors.New("wrong keystore passphrase")
+	ErrUnsupportedKeystore = errors.New("unsupported keystore")
+)
+
+// ScryptParams tune the cost of deriving the keystore key
+type ScryptParams struct {
+	N int
+	R int
+	P int
+}
+
+var (
+	// Same parameters as starkli and eth-keystore
+	DefaultScrypt = ScryptParams{N: 1 << 13, R: 8, P: 1}
+	// Only meant for tests
+	LightScrypt = ScryptParams{N: 1 << 10, R: 8, P: 1}
+)
+
+// Keystore is a Web3 Secret Storage v3 document, the format used by starkli
+// keystores. Both scrypt and pbkdf2 keystores can be opened.
+type Keystore struct {
+	Crypto  keystoreCrypto `json:"crypto"`
+	Id      string         `json:"id"`
+	Version int            `json:"version"`
+}
+
+type keystoreCrypto struct {
+	Cipher       string `json:"cipher"`
+	CipherParams struct {
+		Iv string `json:"iv"`
+	} `json:"cipherparams"`
+	CipherText string          `json:"ciphertext"`
+	Kdf        string          `json:"kdf"`
+	KdfParams  json.RawMessage `json:"kdfparams"`
+	Mac        string          `json:"mac"`
+}
+
+type (
+	scryptKdfParams struct {
+		DkLen int    `json:"dklen"`
+		N     int    `json:"n"`
+		R     int    `json:"r"`
+		P     int    `json:"p"`
+		Salt  string `json:"salt"`
+	}
+	pbkdf2KdfParams struct {
+		DkLen int    `json:"dklen"`
+		C     int    `json:"c"`
+		Prf   string `json:"prf"`
+		Salt  string `json:"salt"`
+	}
+)
+
+// Encrypt seals key with passphrase
+func Encrypt(key *Key, passphrase string, params ScryptParams) (*Keystore, error) {
+	salt := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	id := make([]byte, 16)
+	for _, b := range [][]byte{salt, iv, id} {
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+	}
+
+	derived, err := scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	cipherText, err := aesCtr(derived[:16], iv, key.scalar[:])
+	if err != nil {
+		return nil, err
+	}
+	kdfParams, err := json.Marshal(scryptKdfParams{DkLen: 32, N: params.N, R: params.R, P: params.P, Salt: hex.EncodeToString(salt)})
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &Keystore{Id: uuid(id), Version: 3}
+	ks.Crypto.Cipher = "aes-128-ctr"
+	ks.Crypto.CipherParams.Iv = hex.EncodeToString(iv)
+	ks.Crypto.CipherText = hex.EncodeToString(cipherText)
+	ks.Crypto.Kdf = "scrypt"
+	ks.Crypto.KdfParams = kdfParams
+	ks.Crypto.Mac = hex.EncodeToString(mac(derived, cipherText))
+	return ks, nil
+}
+
+// Decrypt opens the keystore, a mac mismatch is reported as ErrWrongPassphrase
+func (ks *Keystore) Decrypt(passphrase string) (*Key, error) {
+	if ks.Version != 3 || ks.Crypto.Cipher != "aes-128-ctr" {
+		return nil, errors.Wrapf(ErrUnsupportedKeystore, "version %d with cipher %s", ks.Version, ks.Crypto.Cipher)
+	}
+	derived, err := ks.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	cipherText, err := hex.DecodeString(ks.Crypto.CipherText)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid ciphertext")
+	}
+	expected, err := hex.DecodeString(ks.Crypto.Mac)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid mac")
+	}
+	if !hmac.Equal(mac(derived, cipherText), expected) {
+		return nil, ErrWrongPassphrase
+	}
+
+	iv, err := hex.DecodeString(ks.Crypto.CipherParams.Iv)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid iv")
+	}
+	scalar, err := aesCtr(derived[:16], iv, cipherText)
+	if err != nil {
+		return nil, err
+	}
+	return KeyFromBytes(scalar)
+}
+
+func (ks *Keystore) deriveKey(passphrase string) ([]byte, error) {
+	switch ks.Crypto.Kdf {
+	case "scrypt":
+		var params scryptKdfParams
+		if err := json.Unmarshal(ks.Crypto.KdfParams, &params); err != nil {
+			return nil, errors.Wrap(err, "invalid scrypt params")
+		}
+		salt, err := hex.DecodeString(params.Salt)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid salt")
+		}
+		if params.DkLen < 32 {
+			return nil, errors.Wrapf(ErrUnsupportedKeystore, "derived key of %d bytes", params.DkLen)
+		}
+		return scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, params.DkLen)
+	case "pbkdf2":
+		var params pbkdf2KdfParams
+		if err := json.Unmarshal(ks.Crypto.KdfParams, &params); err != nil {
+			return nil, errors.Wrap(err, "invalid pbkdf2 params")
+		}
+		if params.Prf != "hmac-sha256" || params.DkLen < 32 {
+			return nil, errors.Wrapf(ErrUnsupportedKeystore, "pbkdf2 with %s", params.Prf)
+		}
+		salt, err := hex.DecodeString(params.Salt)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid salt")
+		}
+		return pbkdf2.Key([]byte(passphrase), salt, params.C, params.DkLen, sha256.New), nil
+	}
+	return nil, errors.Wrapf(ErrUnsupportedKeystore, "kdf %s", ks.Crypto.Kdf)
+}
+
+// LoadKeystore reads a keystore file without decrypting it
+func LoadKeystore(path string) (*Keystore, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ks Keystore
+	if err := json.Unmarshal(b, &ks); err != nil {
+		return nil, errors.Mark(errors.Wrapf(err, "%s", path), ErrUnsupportedKeystore)
+	}
+	return &ks, nil
+}
+
+// Save writes the keystore readable by its owner only
+func (ks *Keystore) Save(path string) error {
+	b, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600)
+}
+
+func aesCtr(key []byte, iv []byte, in []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, errors.Newf("invalid iv length %d", len(iv))
+	}
+	out := make([]byte, len(in))
+	cipher.NewCTR(block, iv).XORKeyStream(out, in)
+	return out, nil
+}
+
+// keccak256 of the second half of the derived key and the ciphertext
+func mac(derived []byte, cipherText []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(derived[16:32])
+	h.Write(cipherText)
+	return h.Sum(nil)
+}
+
+func uuid(b []byte) string {
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,130 @@
+package signer
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// Signer holds the server Starknet identity
+type Signer interface {
+	PublicKey() *felt.Felt
+	Sign(msgHash *felt.Felt) (*crypto.Signature, error)
+}
+
+// MemorySigner keeps its key in memory only
+type MemorySigner struct {
+	key *Key
+}
+
+func NewMemorySigner(key *Key) *MemorySigner {
+	return &MemorySigner{key: key}
+}
+
+func (s *MemorySigner) PublicKey() *felt.Felt {
+	return s.key.PublicKey()
+}
+
+func (s *MemorySigner) Sign(msgHash *felt.Felt) (*crypto.Signature, error) {
+	return s.key.Sign(msgHash)
+}
+
+// FileSigner signs with the key of a keystore file. The keystore is decrypted
+// once and again whenever the file changes, so keys can be rotated in place.
+type FileSigner struct {
+	Path string
+
+	passphrase string
+	mu         sync.Mutex
+	key        *Key
+	modTime    time.Time
+}
+
+// NewFileSigner opens the keystore at path right away so a wrong passphrase fails early
+func NewFileSigner(path string, passphrase string) (*FileSigner, error) {
+	s := &FileSigner{Path: path, passphrase: passphrase}
+	if _, err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSigner) load() (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		if s.key != nil {
+			slog.Warn("keystore unavailable, keeping the loaded key", "path", s.Path, "error", err)
+			return s.key, nil
+		}
+		return nil, err
+	}
+	if s.key != nil && info.ModTime().Equal(s.modTime) {
+		return s.key, nil
+	}
+
+	ks, err := LoadKeystore(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ks.Decrypt(s.passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if s.key != nil && !s.key.PublicKey().Equal(key.PublicKey()) {
+		slog.Info("signer key rotated", "path", s.Path, "public_key", key.PublicKey().String())
+	}
+	s.key = key
+	s.modTime = info.ModTime()
+	return key, nil
+}
+
+func (s *FileSigner) PublicKey() *felt.Felt {
+	key, err := s.load()
+	if err != nil {
+		slog.Error("failed to load keystore", "path", s.Path, "error", err)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.key.PublicKey()
+	}
+	return key.PublicKey()
+}
+
+func (s *FileSigner) Sign(msgHash *felt.Felt) (*crypto.Signature, error) {
+	key, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return key.Sign(msgHash)
+}
+
+// FromEnv loads the signer from SIGNER_KEYSTORE and SIGNER_PASSWORD, or from a
+// hex SIGNER_PRIVATE_KEY. Without either an ephemeral key is generated.
+func FromEnv() (Signer, error) {
+	if path := os.Getenv("SIGNER_KEYSTORE"); path != "" {
+		return NewFileSigner(path, os.Getenv("SIGNER_PASSWORD"))
+	}
+	if priv := os.Getenv("SIGNER_PRIVATE_KEY"); priv != "" {
+		f, err := new(felt.Felt).SetString(priv)
+		if err != nil {
+			return nil, err
+		}
+		key, err := KeyFromFelt(f)
+		if err != nil {
+			return nil, err
+		}
+		return NewMemorySigner(key), nil
+	}
+	key, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	slog.Warn("no signer configured, using an ephemeral key", "public_key", key.PublicKey().String())
+	return NewMemorySigner(key), nil
+}
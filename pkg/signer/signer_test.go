@@ -0,0 +1,147 @@
+package signer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+)
+
+func feltFromString(t *testing.T, s string) *felt.Felt {
+	t.Helper()
+	f, err := new(felt.Felt).SetString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestPublicKeyDerivation(t *testing.T) {
+	key, err := KeyFromFelt(feltFromString(t, "0x3c1e9550e66958296d11b60f8e8e7a7ad990d07fa65d5f7652c4a6c87d4e3cc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := feltFromString(t, "0x77a3b314db07c45076d11f62b6f9e748a39790441823307743cf00d6597ea43"); !key.PublicKey().Equal(expected) {
+		t.Fatalf("expected %s, got %s", expected, key.PublicKey())
+	}
+
+	if _, err := KeyFromFelt(new(felt.Felt)); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("expected ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgHash := feltFromString(t, "0x6fcff244f63e38b9d88b9e3378d44757710d1b244282b435cb472053c8d78d0")
+	sig, err := NewMemorySigner(key).Sign(msgHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(key.PublicKey(), msgHash, sig) {
+		t.Fatal("signature does not verify")
+	}
+	if Verify(key.PublicKey(), new(felt.Felt).SetUint64(1), sig) {
+		t.Fatal("signature verifies another message")
+	}
+}
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := Encrypt(key, "correct horse", LightScrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "server.json")
+	if err := ks.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("unexpected keystore file %v: %v", info, err)
+	}
+
+	loaded, err := LoadKeystore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := loaded.Decrypt("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decrypted.PrivateKey().Equal(key.PrivateKey()) {
+		t.Fatal("decrypted another key")
+	}
+	if _, err := loaded.Decrypt("wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("expected ErrWrongPassphrase, got %v", err)
+	}
+}
+
+// pbkdf2 test vector of the Web3 Secret Storage definition, its key is an
+// ethereum key above the Stark curve order so only the decryption is checked
+func TestKeystorePbkdf2Vector(t *testing.T) {
+	ks := &Keystore{Version: 3}
+	ks.Crypto.Cipher = "aes-128-ctr"
+	ks.Crypto.CipherParams.Iv = "6087dab2f9fdbbfaddc31a909735c1e6"
+	ks.Crypto.CipherText = "5318b4d5bcd28de64ee5559e671353e16f075ecae9f99c7a79a38af5f869aa46"
+	ks.Crypto.Kdf = "pbkdf2"
+	ks.Crypto.KdfParams = []byte(`{"c":262144,"dklen":32,"prf":"hmac-sha256","salt":"ae3cd4e7013836a3df6bd7241b12db061dbe2c6785853cce422d148a624ce0bd"}`)
+	ks.Crypto.Mac = "517ead924a9d0dc3124507e3393d175ce3ff7c1e96529c6c555ce9e51205e9b2"
+
+	if _, err := ks.Decrypt("testpassword"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("expected the mac to match and the key to be rejected, got %v", err)
+	}
+	if _, err := ks.Decrypt("testpasswore"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("expected ErrWrongPassphrase, got %v", err)
+	}
+}
+
+func TestFileSignerReloadsRotatedKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.json")
+	save := func(modTime time.Time) *Key {
+		key, err := GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ks, err := Encrypt(key, "secret", LightScrypt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ks.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	first := save(time.Now().Add(-time.Hour))
+	s, err := NewFileSigner(path, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.PublicKey().Equal(first.PublicKey()) {
+		t.Fatal("unexpected public key")
+	}
+
+	second := save(time.Now())
+	sig, err := s.Sign(new(felt.Felt).SetUint64(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(second.PublicKey(), new(felt.Felt).SetUint64(42), sig) {
+		t.Fatal("signer did not pick up the rotated key")
+	}
+
+	if _, err := NewFileSigner(path, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("expected ErrWrongPassphrase, got %v", err)
+	}
+}
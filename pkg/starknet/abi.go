@@ -0,0 +1,209 @@
+package starknet
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+)
+
+var (
+	ErrUnknownAbiType     = errors.New("unknown abi type")
+	ErrUnknownAbiFunction = errors.New("unknown abi function")
+	ErrAbiEncode          = errors.New("cannot encode value")
+)
+
+type (
+	AbiParam struct {
+		Name string `json:"name,omitempty"`
+		Type string `json:"type"`
+	}
+	AbiFunction struct {
+		Name            string     `json:"name"`
+		Inputs          []AbiParam `json:"inputs"`
+		Outputs         []AbiParam `json:"outputs"`
+		StateMutability string     `json:"state_mutability"`
+	}
+	AbiStruct struct {
+		Name    string     `json:"name"`
+		Members []AbiParam `json:"members"`
+	}
+	// AbiEnum variants are serialized as their index followed by their value
+	AbiEnum struct {
+		Name     string     `json:"name"`
+		Variants []AbiParam `json:"variants"`
+	}
+)
+
+// Abi is the Sierra ABI of a contract, functions of its interfaces are flattened
+type Abi struct {
+	Functions map[string]*AbiFunction
+	Structs   map[string]*AbiStruct
+	Enums     map[string]*AbiEnum
+}
+
+type abiEntry struct {
+	Type     string     `json:"type"`
+	Name     string     `json:"name"`
+	Kind     string     `json:"kind"`
+	Inputs   []AbiParam `json:"inputs"`
+	Outputs  []AbiParam `json:"outputs"`
+	Members  []AbiParam `json:"members"`
+	Variants []AbiParam `json:"variants"`
+	Items    []abiEntry `json:"items"`
+
+	StateMutability string `json:"state_mutability"`
+}
+
+// ParseAbi reads a Sierra ABI, either as a json array or as the json string
+// returned by starknet_getClass.
+func ParseAbi(b []byte) (*Abi, error) {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		b = []byte(s)
+	}
+	var entries []abiEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, errors.Wrap(err, "invalid abi")
+	}
+
+	abi := &Abi{
+		Functions: make(map[string]*AbiFunction),
+		Structs:   make(map[string]*AbiStruct),
+		Enums:     make(map[string]*AbiEnum),
+	}
+	abi.add(entries)
+	return abi, nil
+}
+
+func MustParseAbi(s string) *Abi {
+	abi, err := ParseAbi([]byte(s))
+	if err != nil {
+		panic(err)
+	}
+	return abi
+}
+
+func (a *Abi) add(entries []abiEntry) {
+	for _, e := range entries {
+		switch e.Type {
+		case "function", "l1_handler":
+			a.Functions[e.Name] = &AbiFunction{Name: e.Name, Inputs: e.Inputs, Outputs: e.Outputs, StateMutability: e.StateMutability}
+		case "struct":
+			a.Structs[e.Name] = &AbiStruct{Name: e.Name, Members: e.Members}
+		case "enum":
+			a.Enums[e.Name] = &AbiEnum{Name: e.Name, Variants: e.Variants}
+		case "interface":
+			a.add(e.Items)
+		}
+	}
+}
+
+func (a *Abi) Function(name string) (*AbiFunction, error) {
+	fn, ok := a.Functions[name]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownAbiFunction, "%s", name)
+	}
+	return fn, nil
+}
+
+// EncodeInputs serializes args into the calldata of function
+func (a *Abi) EncodeInputs(function string, args ...any) ([]felt.Felt, error) {
+	fn, err := a.Function(function)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != len(fn.Inputs) {
+		return nil, errors.Wrapf(ErrAbiEncode, "%s expects %d arguments, got %d", function, len(fn.Inputs), len(args))
+	}
+	calldata := []felt.Felt{}
+	for i, input := range fn.Inputs {
+		calldata, err = a.encode(calldata, input.Type, args[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s(%s)", function, input.Name)
+		}
+	}
+	return calldata, nil
+}
+
+// DecodeOutputs deserializes the result of function, every felt must be consumed
+func (a *Abi) DecodeOutputs(function string, res []felt.Felt) ([]any, error) {
+	fn, err := a.Function(function)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{abi: a, data: res}
+	outputs := make([]any, len(fn.Outputs))
+	for i, output := range fn.Outputs {
+		if outputs[i], err = d.decode(output.Type); err != nil {
+			return nil, errors.Wrapf(err, "%s", function)
+		}
+	}
+	if d.pos != len(res) {
+		return nil, errors.Wrapf(ErrUnexpectedResponse, "%s: %d trailing felts", function, len(res)-d.pos)
+	}
+	return outputs, nil
+}
+
+// Encode serializes a single value of the given cairo type
+func (a *Abi) Encode(typ string, v any) ([]felt.Felt, error) {
+	return a.encode([]felt.Felt{}, typ, v)
+}
+
+// Decode deserializes a single value of the given cairo type and returns the number of felts read
+func (a *Abi) Decode(typ string, data []felt.Felt) (any, int, error) {
+	d := &decoder{abi: a, data: data}
+	v, err := d.decode(typ)
+	return v, d.pos, err
+}
+
+// Call invokes a view function and decodes its outputs
+func (a *Abi) Call(ctx context.Context, rpc StarknetRpcClient, address string, function string, args ...any) ([]any, error) {
+	calldata, err := a.EncodeInputs(function, args...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := rpc.Call(ctx, address, function, calldata)
+	if err != nil {
+		return nil, err
+	}
+	return a.DecodeOutputs(function, res)
+}
+
+// parseType splits a type into its base and generic arguments:
+// core::array::Array::<core::felt252> is core::array::Array with [core::felt252],
+// tuples have an empty base.
+func parseType(typ string) (string, []string) {
+	typ = strings.TrimSpace(typ)
+	if strings.HasPrefix(typ, "(") && strings.HasSuffix(typ, ")") {
+		return "", splitTopLevel(typ[1 : len(typ)-1])
+	}
+	if i := strings.Index(typ, "::<"); i >= 0 && strings.HasSuffix(typ, ">") {
+		return typ[:i], splitTopLevel(typ[i+3 : len(typ)-1])
+	}
+	return typ, nil
+}
+
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '<', '(':
+			depth++
+		case '>', ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		parts = append(parts, last)
+	}
+	return parts
+}
@@ -0,0 +1,357 @@
+package starknet
+
+import (
+	"math/big"
+	"reflect"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+)
+
+// Go representation of cairo values:
+//
+//	felt252, ContractAddress, ClassHash, bytes31, u8…u128  *felt.Felt
+//	u256                                                   *big.Int
+//	bool                                                   bool
+//	ByteArray                                              string
+//	Array, Span, tuples                                    []any
+//	structs                                                map[string]any
+//	enums                                                  Enum
+//	Option                                                 nil or the value
+//
+// Encoding also accepts Go integers, *big.Int and numeric strings for numbers
+// and any slice for arrays.
+
+// Enum is a cairo enum value
+type Enum struct {
+	Variant string
+	Value   any
+}
+
+// bit size of the types serialized as a single felt, zero means the whole field
+var feltTypes = map[string]int{
+	"core::felt252": 0,
+	"core::starknet::contract_address::ContractAddress": 0,
+	"core::starknet::class_hash::ClassHash":             0,
+	"core::starknet::eth_address::EthAddress":           160,
+	"core::bytes_31::bytes31":                           248,
+	"core::integer::u8":                                 8,
+	"core::integer::u16":                                16,
+	"core::integer::u32":                                32,
+	"core::integer::usize":                              32,
+	"core::integer::u64":                                64,
+	"core::integer::u128":                               128,
+}
+
+const (
+	typeBool      = "core::bool"
+	typeU256      = "core::integer::u256"
+	typeByteArray = "core::byte_array::ByteArray"
+	typeArray     = "core::array::Array"
+	typeSpan      = "core::array::Span"
+	typeOption    = "core::option::Option"
+)
+
+var u128Max = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+
+func (a *Abi) encode(out []felt.Felt, typ string, v any) ([]felt.Felt, error) {
+	if bits, ok := feltTypes[typ]; ok {
+		f, err := toFelt(v, bits)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s", typ)
+		}
+		return append(out, *f), nil
+	}
+
+	switch typ {
+	case "()":
+		return out, nil
+	case typeBool:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, errors.Wrapf(ErrAbiEncode, "%s: got %T", typ, v)
+		}
+		if b {
+			return append(out, *FeltFromInt(1)), nil
+		}
+		return append(out, *Zero), nil
+	case typeU256:
+		n, err := toBig(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s", typ)
+		}
+		if n.BitLen() > 256 {
+			return nil, errors.Wrapf(ErrAbiEncode, "%s: %s overflows", typ, n)
+		}
+		low := new(big.Int).And(n, u128Max)
+		high := new(big.Int).Rsh(n, 128)
+		return append(out, *new(felt.Felt).SetBigInt(low), *new(felt.Felt).SetBigInt(high)), nil
+	case typeByteArray:
+		switch s := v.(type) {
+		case string:
+			return append(out, EncodeByteArray(s)...), nil
+		case []byte:
+			return append(out, EncodeByteArray(string(s))...), nil
+		}
+		return nil, errors.Wrapf(ErrAbiEncode, "%s: got %T", typ, v)
+	}
+
+	base, args := parseType(typ)
+	switch {
+	case base == "":
+		values, err := toSlice(v)
+		if err != nil || len(values) != len(args) {
+			return nil, errors.Wrapf(ErrAbiEncode, "%s: got %T", typ, v)
+		}
+		for i, arg := range args {
+			if out, err = a.encode(out, arg, values[i]); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case (base == typeArray || base == typeSpan) && len(args) == 1:
+		values, err := toSlice(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s", typ)
+		}
+		out = append(out, *FeltFromInt(len(values)))
+		for _, value := range values {
+			if out, err = a.encode(out, args[0], value); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case base == typeOption && len(args) == 1:
+		if v == nil {
+			return append(out, *FeltFromInt(1)), nil
+		}
+		return a.encode(append(out, *Zero), args[0], v)
+	}
+
+	if s, ok := a.Structs[typ]; ok {
+		fields, ok := v.(map[string]any)
+		if !ok {
+			return nil, errors.Wrapf(ErrAbiEncode, "%s: got %T", typ, v)
+		}
+		var err error
+		for _, m := range s.Members {
+			field, ok := fields[m.Name]
+			if !ok {
+				return nil, errors.Wrapf(ErrAbiEncode, "%s: missing member %s", typ, m.Name)
+			}
+			if out, err = a.encode(out, m.Type, field); err != nil {
+				return nil, errors.Wrapf(err, "%s.%s", typ, m.Name)
+			}
+		}
+		return out, nil
+	}
+	if e, ok := a.Enums[typ]; ok {
+		value, ok := v.(Enum)
+		if !ok {
+			return nil, errors.Wrapf(ErrAbiEncode, "%s: got %T", typ, v)
+		}
+		for i, variant := range e.Variants {
+			if variant.Name == value.Variant {
+				return a.encode(append(out, *FeltFromInt(i)), variant.Type, value.Value)
+			}
+		}
+		return nil, errors.Wrapf(ErrAbiEncode, "%s: unknown variant %s", typ, value.Variant)
+	}
+	return nil, errors.Wrapf(ErrUnknownAbiType, "%s", typ)
+}
+
+type decoder struct {
+	abi  *Abi
+	data []felt.Felt
+	pos  int
+}
+
+func (d *decoder) next(typ string) (*felt.Felt, error) {
+	if d.pos >= len(d.data) {
+		return nil, errors.Wrapf(ErrUnexpectedResponse, "%s: result too short", typ)
+	}
+	f := d.data[d.pos]
+	d.pos++
+	return &f, nil
+}
+
+// length reads an array length and checks it against the remaining felts
+func (d *decoder) length(typ string) (int, error) {
+	f, err := d.next(typ)
+	if err != nil {
+		return 0, err
+	}
+	if !f.IsZero() && (!isUint(f, 32) || f.Uint64() > uint64(len(d.data)-d.pos)) {
+		return 0, errors.Wrapf(ErrUnexpectedResponse, "%s: invalid length %s", typ, f)
+	}
+	return int(f.Uint64()), nil
+}
+
+func (d *decoder) variant(typ string, count int) (int, error) {
+	f, err := d.next(typ)
+	if err != nil {
+		return 0, err
+	}
+	if !isUint(f, 32) || f.Uint64() >= uint64(count) {
+		return 0, errors.Wrapf(ErrUnexpectedResponse, "%s: invalid variant %s", typ, f)
+	}
+	return int(f.Uint64()), nil
+}
+
+func (d *decoder) decode(typ string) (any, error) {
+	if bits, ok := feltTypes[typ]; ok {
+		f, err := d.next(typ)
+		if err != nil {
+			return nil, err
+		}
+		if bits > 0 && !isUint(f, bits) {
+			return nil, errors.Wrapf(ErrUnexpectedResponse, "%s: %s overflows", typ, f)
+		}
+		return f, nil
+	}
+
+	switch typ {
+	case "()":
+		return nil, nil
+	case typeBool:
+		i, err := d.variant(typ, 2)
+		return i == 1, err
+	case typeU256:
+		low, err := d.next(typ)
+		if err != nil {
+			return nil, err
+		}
+		high, err := d.next(typ)
+		if err != nil {
+			return nil, err
+		}
+		if !isUint(low, 128) || !isUint(high, 128) {
+			return nil, errors.Wrapf(ErrUnexpectedResponse, "%s: limb overflows u128", typ)
+		}
+		n := high.BigInt(new(big.Int))
+		return n.Lsh(n, 128).Or(n, low.BigInt(new(big.Int))), nil
+	case typeByteArray:
+		s, n, err := DecodeByteArray(d.data[d.pos:])
+		d.pos += n
+		return s, err
+	}
+
+	base, args := parseType(typ)
+	switch {
+	case base == "":
+		values := make([]any, len(args))
+		for i, arg := range args {
+			v, err := d.decode(arg)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	case (base == typeArray || base == typeSpan) && len(args) == 1:
+		n, err := d.length(typ)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]any, n)
+		for i := range values {
+			if values[i], err = d.decode(args[0]); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	case base == typeOption && len(args) == 1:
+		i, err := d.variant(typ, 2)
+		if err != nil || i == 1 {
+			return nil, err
+		}
+		return d.decode(args[0])
+	}
+
+	if s, ok := d.abi.Structs[typ]; ok {
+		fields := make(map[string]any, len(s.Members))
+		for _, m := range s.Members {
+			v, err := d.decode(m.Type)
+			if err != nil {
+				return nil, err
+			}
+			fields[m.Name] = v
+		}
+		return fields, nil
+	}
+	if e, ok := d.abi.Enums[typ]; ok {
+		i, err := d.variant(typ, len(e.Variants))
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.decode(e.Variants[i].Type)
+		if err != nil {
+			return nil, err
+		}
+		return Enum{Variant: e.Variants[i].Name, Value: v}, nil
+	}
+	return nil, errors.Wrapf(ErrUnknownAbiType, "%s", typ)
+}
+
+// isUint reports whether f fits in an unsigned integer of the given bit size
+func isUint(f *felt.Felt, bits int) bool {
+	return f.BigInt(new(big.Int)).BitLen() <= bits
+}
+
+func toBig(v any) (*big.Int, error) {
+	var n *big.Int
+	switch v := v.(type) {
+	case *big.Int:
+		n = v
+	case *felt.Felt:
+		n = v.BigInt(new(big.Int))
+	case felt.Felt:
+		n = v.BigInt(new(big.Int))
+	case string:
+		var ok bool
+		if n, ok = new(big.Int).SetString(v, 0); !ok {
+			return nil, errors.Wrapf(ErrAbiEncode, "invalid number %q", v)
+		}
+	default:
+		rv := reflect.ValueOf(v)
+		switch {
+		case rv.CanInt():
+			n = big.NewInt(rv.Int())
+		case rv.CanUint():
+			n = new(big.Int).SetUint64(rv.Uint())
+		default:
+			return nil, errors.Wrapf(ErrAbiEncode, "got %T", v)
+		}
+	}
+	if n.Sign() < 0 {
+		return nil, errors.Wrapf(ErrAbiEncode, "negative number %s", n)
+	}
+	return n, nil
+}
+
+func toFelt(v any, bits int) (*felt.Felt, error) {
+	n, err := toBig(v)
+	if err != nil {
+		return nil, err
+	}
+	f := new(felt.Felt).SetBigInt(n)
+	if f.BigInt(new(big.Int)).Cmp(n) != 0 || (bits > 0 && n.BitLen() > bits) {
+		return nil, errors.Wrapf(ErrAbiEncode, "%s overflows", n)
+	}
+	return f, nil
+}
+
+func toSlice(v any) ([]any, error) {
+	if values, ok := v.([]any); ok {
+		return values, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, errors.Wrapf(ErrAbiEncode, "expected a slice, got %T", v)
+	}
+	values := make([]any, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values, nil
+}
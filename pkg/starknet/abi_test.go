@@ -0,0 +1,190 @@
+package starknet
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+)
+
+const gameAbi = `[
+	{
+		"type": "impl",
+		"name": "GameImpl",
+		"interface_name": "memo::IGame"
+	},
+	{
+		"type": "struct",
+		"name": "core::integer::u256",
+		"members": [
+			{"name": "low", "type": "core::integer::u128"},
+			{"name": "high", "type": "core::integer::u128"}
+		]
+	},
+	{
+		"type": "struct",
+		"name": "memo::Tile",
+		"members": [
+			{"name": "x", "type": "core::integer::u8"},
+			{"name": "y", "type": "core::integer::u8"},
+			{"name": "token_id", "type": "core::integer::u256"}
+		]
+	},
+	{
+		"type": "enum",
+		"name": "memo::Status",
+		"variants": [
+			{"name": "Waiting", "type": "()"},
+			{"name": "Playing", "type": "core::starknet::contract_address::ContractAddress"},
+			{"name": "Finished", "type": "(core::integer::u32, core::bool)"}
+		]
+	},
+	{
+		"type": "interface",
+		"name": "memo::IGame",
+		"items": [
+			{
+				"type": "function",
+				"name": "match_tiles",
+				"inputs": [
+					{"name": "tiles", "type": "core::array::Span::<memo::Tile>"},
+					{"name": "name", "type": "core::byte_array::ByteArray"},
+					{"name": "bet", "type": "core::option::Option::<core::integer::u256>"}
+				],
+				"outputs": [],
+				"state_mutability": "external"
+			},
+			{
+				"type": "function",
+				"name": "status",
+				"inputs": [],
+				"outputs": [
+					{"type": "memo::Status"},
+					{"type": "core::array::Array::<core::felt252>"}
+				],
+				"state_mutability": "view"
+			}
+		]
+	}
+]`
+
+func felts(values ...uint64) []felt.Felt {
+	res := make([]felt.Felt, len(values))
+	for i, v := range values {
+		res[i].SetUint64(v)
+	}
+	return res
+}
+
+func TestAbiEncodeInputs(t *testing.T) {
+	abi := MustParseAbi(gameAbi)
+	if _, ok := abi.Structs["memo::Tile"]; !ok {
+		t.Fatal("struct not parsed")
+	}
+
+	tokenId := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(2), 128), big.NewInt(7))
+	calldata, err := abi.EncodeInputs("match_tiles",
+		[]map[string]any{
+			{"x": 1, "y": 2, "token_id": tokenId},
+			{"x": 3, "y": 4, "token_id": 5},
+		},
+		"memo",
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memo := new(felt.Felt).SetBytes([]byte("memo")).Uint64()
+	expected := felts(2, 1, 2, 7, 2, 3, 4, 5, 0, 0, memo, 4, 1)
+	if !reflect.DeepEqual(calldata, expected) {
+		t.Fatalf("expected %v, got %v", expected, calldata)
+	}
+
+	calldata, err = abi.EncodeInputs("match_tiles", []any{}, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := felts(0, 0, 0, 0, 0, 10, 0); !reflect.DeepEqual(calldata, expected) {
+		t.Fatalf("expected %v, got %v", expected, calldata)
+	}
+}
+
+func TestAbiEncodeRejectsInvalidValues(t *testing.T) {
+	abi := MustParseAbi(gameAbi)
+	tile := func(x any) []map[string]any {
+		return []map[string]any{{"x": x, "y": 0, "token_id": 0}}
+	}
+	for name, args := range map[string][]any{
+		"u8 overflow":    {tile(256), "", nil},
+		"negative":       {tile(-1), "", nil},
+		"missing member": {[]map[string]any{{"x": 1}}, "", nil},
+		"wrong type":     {tile(0), 42, nil},
+		"arity":          {tile(0), ""},
+	} {
+		if _, err := abi.EncodeInputs("match_tiles", args...); !errors.Is(err, ErrAbiEncode) {
+			t.Errorf("%s: expected ErrAbiEncode, got %v", name, err)
+		}
+	}
+	if _, err := abi.EncodeInputs("spawn"); !errors.Is(err, ErrUnknownAbiFunction) {
+		t.Errorf("expected ErrUnknownAbiFunction, got %v", err)
+	}
+}
+
+func TestAbiDecodeOutputs(t *testing.T) {
+	abi := MustParseAbi(gameAbi)
+
+	outputs, err := abi.DecodeOutputs("status", felts(2, 12, 1, 3, 10, 20, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := outputs[0].(Enum)
+	if status.Variant != "Finished" {
+		t.Fatalf("unexpected variant %s", status.Variant)
+	}
+	finished := status.Value.([]any)
+	if finished[0].(*felt.Felt).Uint64() != 12 || finished[1] != true {
+		t.Fatalf("unexpected value %v", finished)
+	}
+	if values := outputs[1].([]any); len(values) != 3 || values[2].(*felt.Felt).Uint64() != 30 {
+		t.Fatalf("unexpected array %v", values)
+	}
+
+	for name, res := range map[string][]felt.Felt{
+		"unknown variant": felts(3, 0),
+		"short":           felts(1),
+		"array too long":  felts(0, 5, 1),
+		"trailing felts":  felts(0, 0, 9),
+		"bool overflow":   felts(2, 1, 2, 0),
+	} {
+		if _, err := abi.DecodeOutputs("status", res); !errors.Is(err, ErrUnexpectedResponse) {
+			t.Errorf("%s: expected ErrUnexpectedResponse, got %v", name, err)
+		}
+	}
+}
+
+func TestAbiRoundTrip(t *testing.T) {
+	abi := MustParseAbi(gameAbi)
+	max256 := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+	for typ, value := range map[string]any{
+		"core::integer::u256":                               max256,
+		"core::byte_array::ByteArray":                       "ipfs://bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi/1.json",
+		"core::option::Option::<core::integer::u256>":       big.NewInt(9),
+		"memo::Status":                                      Enum{Variant: "Waiting"},
+		"(core::bool, core::array::Array::<core::felt252>)": []any{false, []any{FeltFromInt(4)}},
+	} {
+		data, err := abi.Encode(typ, value)
+		if err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		decoded, n, err := abi.Decode(typ, data)
+		if err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		if n != len(data) || !reflect.DeepEqual(decoded, value) {
+			t.Errorf("%s: expected %v, got %v", typ, value, decoded)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package starknet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/MartianGreed/memo-backend/pkg/metrics"
+)
+
+// BatchCall is one request of a JSON-RPC batch. Result must be a pointer the
+// result is decoded into, Err is set when this request failed on its own.
+type BatchCall struct {
+	Method string
+	Params any
+	Result any
+	Err    error
+}
+
+type BatchStarknetRpcClient interface {
+	StarknetRpcClient
+	Batch(ctx context.Context, calls []*BatchCall) error
+}
+
+// NewCallBatchCall prepares a starknet_call to send in a batch
+func NewCallBatchCall(address string, method string, params []felt.Felt) *BatchCall {
+	return &BatchCall{
+		Method: "starknet_call",
+		Params: newCallRequestParams(address, method, params, BlockLatest),
+		Result: &[]felt.Felt{},
+	}
+}
+
+// Batch sends every call in a single JSON-RPC batch and matches the responses
+// by id. The returned error is set when the batch as a whole failed, errors of
+// single calls are reported in their Err field.
+func (c *JsonRpcStarknetClient) Batch(ctx context.Context, calls []*BatchCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	byId := make(map[uint64]*BatchCall, len(calls))
+	requests := make([]*rpcRequest[any], len(calls))
+	for i, call := range calls {
+		id := c.nextId.Add(1)
+		byId[id] = call
+		requests[i] = newRpcRequest(id, call.Method, call.Params)
+	}
+	jsonBody, err := json.Marshal(requests)
+	if err != nil {
+		return err
+	}
+
+	// the size is kept out of the method label, it would be a time series per size
+	label := "batch"
+	metrics.RpcBatchSize.Observe(float64(len(calls)))
+	return c.send(ctx, label, jsonBody, func(body []byte) error {
+		// a server refusing the whole batch answers with a single response
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '{' {
+			var response rpcResponse
+			if err := json.Unmarshal(trimmed, &response); err != nil {
+				return errors.Mark(err, ErrUnexpectedResponse)
+			}
+			if err := response.decode(label, nil); err != nil {
+				return err
+			}
+			return errors.Wrapf(ErrUnexpectedResponse, "%s: expected an array", label)
+		}
+
+		var responses []rpcResponse
+		if err := json.Unmarshal(body, &responses); err != nil {
+			return errors.Mark(err, ErrUnexpectedResponse)
+		}
+		for _, call := range calls {
+			call.Err = nil
+		}
+		seen := make(map[uint64]bool, len(responses))
+		for _, response := range responses {
+			if response.Id == nil {
+				continue
+			}
+			call, ok := byId[*response.Id]
+			if !ok {
+				continue
+			}
+			seen[*response.Id] = true
+			call.Err = response.decode(call.Method, call.Result)
+		}
+		for id, call := range byId {
+			if !seen[id] {
+				call.Err = errors.Wrapf(ErrUnexpectedResponse, "%s: no response for id %d", call.Method, id)
+			}
+		}
+		return nil
+	}, attribute.Int("rpc.batch.size", len(calls)))
+}
+
+// GetTokenUris fetches the token uri of every token in one batch. Tokens
+// that failed are reported in the errors map.
+func GetTokenUris(ctx context.Context, rpc BatchStarknetRpcClient, address string, tokenIds []int) (map[int]string, map[int]error, error) {
+	calls := make([]*BatchCall, len(tokenIds))
+	for i, tokenId := range tokenIds {
+		calldata, err := erc721MetadataAbi.EncodeInputs("token_uri", tokenId)
+		if err != nil {
+			return nil, nil, err
+		}
+		calls[i] = NewCallBatchCall(address, "token_uri", calldata)
+	}
+	if err := rpc.Batch(ctx, calls); err != nil {
+		return nil, nil, err
+	}
+
+	uris := make(map[int]string)
+	failed := make(map[int]error)
+	for i, call := range calls {
+		uri, err := decodeTokenUri(tokenIds[i], *call.Result.(*[]felt.Felt), call.Err)
+		if err != nil {
+			failed[tokenIds[i]] = err
+			continue
+		}
+		uris[tokenIds[i]] = uri
+	}
+	return uris, failed, nil
+}
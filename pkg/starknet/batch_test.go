@@ -0,0 +1,78 @@
+package starknet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+)
+
+// shortByteArray encodes a string of less than 31 bytes as a ByteArray result
+func shortByteArray(s string) string {
+	return fmt.Sprintf(`["0x0","%s","0x%x"]`, new(felt.Felt).SetBytes([]byte(s)).String(), len(s))
+}
+
+func TestBatchMatchesResponsesById(t *testing.T) {
+	var posts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts.Add(1)
+		var requests []struct {
+			Id     uint64 `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				Request callRequest `json:"request"`
+			} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requests); err != nil {
+			t.Errorf("expected a batch: %v", err)
+			return
+		}
+
+		var responses []string
+		// answer in reverse order, skipping the last request
+		for i := len(requests) - 2; i >= 0; i-- {
+			req := requests[i]
+			tokenId, _ := new(felt.Felt).SetString(req.Params.Request.Calldata[0])
+			if tokenId.Uint64() == 2 {
+				responses = append(responses, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"error":{"code":40,"message":"Contract error","data":{"revert_error":"invalid token"}}}`, req.Id))
+				continue
+			}
+			responses = append(responses, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":%s}`, req.Id, shortByteArray(fmt.Sprintf("uri-%d", tokenId.Uint64()))))
+		}
+		_, _ = w.Write([]byte("[" + strings.Join(responses, ",") + "]"))
+	}))
+	defer srv.Close()
+
+	c := NewJsonRpcStarknetClient(srv.URL)
+	uris, failed, err := GetTokenUris(context.Background(), c, "0x539", []int{1, 2, 3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if posts.Load() != 1 {
+		t.Fatalf("expected a single round trip, got %d", posts.Load())
+	}
+	if len(uris) != 2 || uris[1] != "uri-1" || uris[3] != "uri-3" {
+		t.Fatalf("unexpected uris %v", uris)
+	}
+	if !errors.Is(failed[2], ErrContractError) {
+		t.Fatalf("expected contract error for token 2, got %v", failed[2])
+	}
+	if !errors.Is(failed[4], ErrUnexpectedResponse) {
+		t.Fatalf("expected missing response for token 4, got %v", failed[4])
+	}
+}
+
+func TestBatchRejectedAsAWhole(t *testing.T) {
+	c := newRawTestNode(t, http.StatusOK, `{"jsonrpc":"2.0","id":null,"error":{"code":-32602,"message":"Invalid params"}}`)
+	err := c.Batch(context.Background(), []*BatchCall{{Method: "starknet_blockNumber", Params: []any{}}})
+	if !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("expected ErrInvalidParams, got %v", err)
+	}
+}
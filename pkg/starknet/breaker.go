@@ -0,0 +1,74 @@
+package starknet
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker stops sending requests to an endpoint after too many
+// consecutive failures, and lets a single probe through once Cooldown elapsed.
+type CircuitBreaker struct {
+	// Consecutive failures before the circuit opens
+	Threshold int
+	Cooldown  time.Duration
+
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+	sync.Mutex
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{Threshold: threshold, Cooldown: cooldown, now: time.Now}
+}
+
+// Allow reports whether a request may be sent
+func (b *CircuitBreaker) Allow() error {
+	b.Lock()
+	defer b.Unlock()
+	if b.failures < b.Threshold {
+		return nil
+	}
+	if b.probing || b.now().Sub(b.openedAt) < b.Cooldown {
+		return ErrCircuitOpen
+	}
+	// half open, let one request probe the endpoint
+	b.probing = true
+	return nil
+}
+
+func (b *CircuitBreaker) Success() {
+	b.Lock()
+	defer b.Unlock()
+	b.failures = 0
+	b.probing = false
+}
+
+// Release ends a request that neither proved nor disproved the endpoint
+// health, such as a cancelled one, a half open circuit lets the next probe in
+func (b *CircuitBreaker) Release() {
+	b.Lock()
+	defer b.Unlock()
+	b.probing = false
+}
+
+func (b *CircuitBreaker) Failure() {
+	b.Lock()
+	defer b.Unlock()
+	b.failures++
+	b.probing = false
+	if b.failures >= b.Threshold {
+		b.openedAt = b.now()
+	}
+}
+
+func (b *CircuitBreaker) Open() bool {
+	b.Lock()
+	defer b.Unlock()
+	return b.failures >= b.Threshold
+}
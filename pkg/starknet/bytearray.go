@@ -0,0 +1,81 @@
+package starknet
+
+import (
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+)
+
+// a short string or a ByteArray word holds at most 31 bytes
+const bytes31Len = 31
+
+var ErrInvalidShortString = errors.New("invalid short string")
+
+// EncodeShortString packs up to 31 ASCII characters into a felt, big endian
+func EncodeShortString(s string) (*felt.Felt, error) {
+	if len(s) > bytes31Len {
+		return nil, errors.Wrapf(ErrInvalidShortString, "%q is longer than %d bytes", s, bytes31Len)
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] > 0x7f {
+			return nil, errors.Wrapf(ErrInvalidShortString, "%q is not ascii", s)
+		}
+	}
+	return new(felt.Felt).SetBytes([]byte(s)), nil
+}
+
+// DecodeShortString unpacks a felt into its characters. Leading zero bytes
+// are not part of the value so they can not be recovered.
+func DecodeShortString(f *felt.Felt) (string, error) {
+	if !isUint(f, 8*bytes31Len) {
+		return "", errors.Wrapf(ErrInvalidShortString, "%s is longer than %d bytes", f, bytes31Len)
+	}
+	b := f.Bytes()
+	i := 0
+	for i < len(b) && b[i] == 0 {
+		i++
+	}
+	return string(b[i:]), nil
+}
+
+// EncodeByteArray serializes s as a cairo ByteArray: data_len, data_len words
+// of 31 bytes, pending_word and pending_word_len. Any byte, NUL included, is kept.
+func EncodeByteArray(s string) []felt.Felt {
+	b := []byte(s)
+	out := []felt.Felt{*FeltFromInt(len(b) / bytes31Len)}
+	for ; len(b) >= bytes31Len; b = b[bytes31Len:] {
+		out = append(out, *new(felt.Felt).SetBytes(b[:bytes31Len]))
+	}
+	return append(out, *new(felt.Felt).SetBytes(b), *FeltFromInt(len(b)))
+}
+
+// DecodeByteArray deserializes a ByteArray from the start of data and returns
+// the number of felts it spans.
+func DecodeByteArray(data []felt.Felt) (string, int, error) {
+	d := &decoder{data: data}
+	n, err := d.length(typeByteArray)
+	if err != nil {
+		return "", d.pos, err
+	}
+	b := make([]byte, 0, (n+1)*bytes31Len)
+	for i := 0; i < n; i++ {
+		word, _ := d.next(typeByteArray)
+		if !isUint(word, 8*bytes31Len) {
+			return "", d.pos, errors.Wrapf(ErrUnexpectedResponse, "%s: word %d overflows bytes31", typeByteArray, i)
+		}
+		bytes := word.Bytes()
+		b = append(b, bytes[32-bytes31Len:]...)
+	}
+	pending, err := d.next(typeByteArray)
+	if err != nil {
+		return "", d.pos, err
+	}
+	pendingLen, err := d.next(typeByteArray)
+	if err != nil {
+		return "", d.pos, err
+	}
+	if !isUint(pendingLen, 8) || pendingLen.Uint64() >= bytes31Len || !isUint(pending, 8*int(pendingLen.Uint64())) {
+		return "", d.pos, errors.Wrapf(ErrUnexpectedResponse, "%s: invalid pending word", typeByteArray)
+	}
+	bytes := pending.Bytes()
+	return string(append(b, bytes[32-pendingLen.Uint64():]...)), d.pos, nil
+}
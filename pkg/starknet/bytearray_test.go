@@ -0,0 +1,91 @@
+package starknet
+
+import (
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+)
+
+func TestByteArrayRoundTrip(t *testing.T) {
+	roundTrip := func(b []byte) bool {
+		data := EncodeByteArray(string(b))
+		s, n, err := DecodeByteArray(data)
+		return err == nil && n == len(data) && s == string(b)
+	}
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 500}); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"", "\x00", "\x00\x00abc\x00", strings.Repeat("a", 31), strings.Repeat("\x00", 62) + "z"} {
+		if !roundTrip([]byte(s)) {
+			t.Errorf("round trip failed for %q", s)
+		}
+	}
+}
+
+func TestByteArrayLayout(t *testing.T) {
+	s := "data:application/json;base64,eyJuYW1lIjoiYmxvYmVydCJ9"
+	data := EncodeByteArray(s)
+	if len(data) != 4 || data[0].Uint64() != 1 || data[3].Uint64() != uint64(len(s)-31) {
+		t.Fatalf("unexpected layout %v", data)
+	}
+	if word := data[1].Bytes(); string(word[1:]) != s[:31] {
+		t.Fatalf("unexpected first word %q", word)
+	}
+
+	// a trailing felt belongs to the caller
+	decoded, n, err := DecodeByteArray(append(data, *FeltFromInt(7)))
+	if err != nil || decoded != s || n != 4 {
+		t.Fatalf("unexpected decode %q %d %v", decoded, n, err)
+	}
+}
+
+func TestDecodeByteArrayRejectsMalformed(t *testing.T) {
+	tooBig := new(felt.Felt).SetBytes([]byte(strings.Repeat("a", 32)))
+	for name, data := range map[string][]felt.Felt{
+		"empty":               {},
+		"missing pending":     felts(0, 0),
+		"data_len too big":    felts(5, 1, 2, 3),
+		"pending_len too big": felts(0, 0, 31),
+		"pending overflows":   felts(0, 0x6162, 1),
+		"word overflows":      {*FeltFromInt(1), *tooBig, *Zero, *Zero},
+	} {
+		if _, _, err := DecodeByteArray(data); !errors.Is(err, ErrUnexpectedResponse) {
+			t.Errorf("%s: expected ErrUnexpectedResponse, got %v", name, err)
+		}
+	}
+}
+
+func TestShortStringRoundTrip(t *testing.T) {
+	roundTrip := func(b []byte) bool {
+		s := strings.TrimLeft(strings.Map(func(r rune) rune { return r & 0x7f }, string(b)), "\x00")
+		if len(s) > 31 {
+			s = s[:31]
+		}
+		f, err := EncodeShortString(s)
+		if err != nil {
+			return false
+		}
+		decoded, err := DecodeShortString(f)
+		return err == nil && decoded == s
+	}
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 500}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := EncodeShortString("SN_MAIN")
+	if err != nil || f.String() != "0x534e5f4d41494e" {
+		t.Fatalf("unexpected encoding %v %v", f, err)
+	}
+	if _, err := EncodeShortString(strings.Repeat("a", 32)); !errors.Is(err, ErrInvalidShortString) {
+		t.Fatalf("expected ErrInvalidShortString, got %v", err)
+	}
+	if _, err := EncodeShortString("é"); !errors.Is(err, ErrInvalidShortString) {
+		t.Fatalf("expected ErrInvalidShortString, got %v", err)
+	}
+	if _, err := DecodeShortString(new(felt.Felt).SetBytes([]byte(strings.Repeat("a", 32)))); !errors.Is(err, ErrInvalidShortString) {
+		t.Fatalf("expected ErrInvalidShortString, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package starknet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Errors defined by the Starknet JSON-RPC specification, match them with errors.Is
+var (
+	ErrFailedToReceiveTxn       = errors.New("failed to write transaction")
+	ErrContractNotFound         = errors.New("contract not found")
+	ErrEntrypointNotFound       = errors.New("requested entrypoint does not exist in the contract")
+	ErrBlockNotFound            = errors.New("block not found")
+	ErrInvalidTxnIndex          = errors.New("invalid transaction index in a block")
+	ErrClassHashNotFound        = errors.New("class hash not found")
+	ErrTxnHashNotFound          = errors.New("transaction hash not found")
+	ErrPageSizeTooBig           = errors.New("requested page size is too big")
+	ErrNoBlocks                 = errors.New("there are no blocks")
+	ErrInvalidContinuationToken = errors.New("the supplied continuation token is invalid or unknown")
+	ErrTooManyKeysInFilter      = errors.New("too many keys provided in a filter")
+	ErrContractError            = errors.New("contract error")
+	ErrInvalidParams            = errors.New("invalid params")
+	ErrMethodNotFound           = errors.New("method not found")
+	ErrInternal                 = errors.New("internal error")
+
+	ErrRateLimited        = errors.New("rate limited")
+	ErrUnavailable        = errors.New("rpc endpoint unavailable")
+	ErrUnexpectedResponse = errors.New("unexpected rpc response")
+)
+
+var rpcErrorCodes = map[int]error{
+	1:      ErrFailedToReceiveTxn,
+	20:     ErrContractNotFound,
+	21:     ErrEntrypointNotFound,
+	24:     ErrBlockNotFound,
+	27:     ErrInvalidTxnIndex,
+	28:     ErrClassHashNotFound,
+	29:     ErrTxnHashNotFound,
+	31:     ErrPageSizeTooBig,
+	32:     ErrNoBlocks,
+	33:     ErrInvalidContinuationToken,
+	34:     ErrTooManyKeysInFilter,
+	40:     ErrContractError,
+	-32602: ErrInvalidParams,
+	-32601: ErrMethodNotFound,
+	-32603: ErrInternal,
+	// used by most providers when a quota is exceeded
+	-32005: ErrRateLimited,
+}
+
+// RpcError is the error object of a JSON-RPC response
+type RpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RpcError) Error() string {
+	if len(e.Data) > 0 {
+		return fmt.Sprintf("rpc error %d: %s: %s", e.Code, e.Message, e.Data)
+	}
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// RevertError returns the revert reason carried by contract errors
+func (e *RpcError) RevertError() string {
+	var data struct {
+		RevertError string `json:"revert_error"`
+	}
+	if err := json.Unmarshal(e.Data, &data); err == nil && data.RevertError != "" {
+		return data.RevertError
+	}
+	var s string
+	if err := json.Unmarshal(e.Data, &s); err == nil {
+		return s
+	}
+	return string(e.Data)
+}
+
+func newRpcError(e *RpcError) error {
+	if sentinel, ok := rpcErrorCodes[e.Code]; ok {
+		return errors.Mark(e, sentinel)
+	}
+	return e
+}
+
+// HttpError is returned when the endpoint answers with a non 200 status
+type HttpError struct {
+	StatusCode int
+	Status     string
+	Body       string
+	// Parsed from the Retry-After header, zero when absent
+	RetryAfter time.Duration
+}
+
+func (e *HttpError) Error() string {
+	return fmt.Sprintf("http status %s: %.200s", e.Status, e.Body)
+}
+
+func newHttpError(resp *http.Response, body []byte) error {
+	err := &HttpError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return errors.Mark(err, ErrRateLimited)
+	case resp.StatusCode >= 500:
+		return errors.Mark(err, ErrUnavailable)
+	}
+	return err
+}
+
+// RevertReason extracts the revert reason of a failed contract call
+func RevertReason(err error) (string, bool) {
+	var rpcErr *RpcError
+	if !errors.Is(err, ErrContractError) || !errors.As(err, &rpcErr) {
+		return "", false
+	}
+	return rpcErr.RevertError(), true
+}
+
+// callStatus labels the outcome of an rpc call for metrics
+func callStatus(err error) string {
+	var rpcErr *RpcError
+	var httpErr *HttpError
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.As(err, &rpcErr):
+		return "rpc_error"
+	case errors.As(err, &httpErr):
+		return strconv.Itoa(httpErr.StatusCode)
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	return "error"
+}
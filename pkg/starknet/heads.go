@@ -0,0 +1,230 @@
+package starknet
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+	"golang.org/x/net/websocket"
+)
+
+var ErrTransactionReverted = errors.New("transaction reverted")
+
+// HeadClient is the subset of the rpc client needed to follow the chain head
+type HeadClient interface {
+	GetBlockWithTxHashes(ctx context.Context, blockId BlockId) (*BlockWithTxHashes, error)
+}
+
+// HeadFeed follows new block headers, through starknet_subscribeNewHeads when
+// WsUrl is set and by polling the latest block otherwise. A header whose
+// number is not above the previous one means the chain was reorganized.
+type HeadFeed struct {
+	Client HeadClient
+	// Websocket endpoint, polling is used while it is unset or unreachable
+	WsUrl    string
+	Interval time.Duration
+	// Missed blocks are fetched one by one as long as the gap is below MaxGap
+	MaxGap uint64
+	// How long to poll before trying the websocket again
+	WsRetry time.Duration
+
+	mu   sync.Mutex
+	last *BlockHeader
+	subs map[chan BlockHeader]struct{}
+}
+
+func NewHeadFeed(client HeadClient, wsUrl string) *HeadFeed {
+	return &HeadFeed{
+		Client:   client,
+		WsUrl:    wsUrl,
+		Interval: 5 * time.Second,
+		MaxGap:   20,
+		WsRetry:  time.Minute,
+		subs:     make(map[chan BlockHeader]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving every new header. Headers are dropped
+// for subscribers that fall more than buffer headers behind.
+func (f *HeadFeed) Subscribe(buffer int) (<-chan BlockHeader, func()) {
+	ch := make(chan BlockHeader, max(buffer, 1))
+	f.mu.Lock()
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			f.mu.Lock()
+			delete(f.subs, ch)
+			f.mu.Unlock()
+		})
+	}
+}
+
+// Latest returns the last header seen, nil before the first one
+func (f *HeadFeed) Latest() *BlockHeader {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.last
+}
+
+func (f *HeadFeed) publish(header BlockHeader) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.last != nil && f.last.BlockHash != nil && f.last.BlockHash.Equal(header.BlockHash) {
+		return
+	}
+	f.last = &header
+	for ch := range f.subs {
+		select {
+		case ch <- header:
+		default:
+			slog.Warn("dropping block header for slow subscriber", "block", header.BlockNumber)
+		}
+	}
+}
+
+// Run follows the chain until ctx is done
+func (f *HeadFeed) Run(ctx context.Context) error {
+	for {
+		if f.WsUrl != "" {
+			err := f.subscribe(ctx)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			slog.Warn("new heads subscription failed, polling", "endpoint", f.WsUrl, "error", err)
+		}
+
+		pollCtx := ctx
+		var cancel context.CancelFunc = func() {}
+		if f.WsUrl != "" {
+			pollCtx, cancel = context.WithTimeout(ctx, f.WsRetry)
+		}
+		f.poll(pollCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+func (f *HeadFeed) poll(ctx context.Context) {
+	t := time.NewTicker(f.Interval)
+	defer t.Stop()
+	for {
+		if err := f.pollOnce(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("failed to poll latest block", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (f *HeadFeed) pollOnce(ctx context.Context) error {
+	block, err := f.Client.GetBlockWithTxHashes(ctx, BlockLatest)
+	if err != nil {
+		return err
+	}
+	last := f.Latest()
+	if last != nil && block.BlockNumber > last.BlockNumber+1 && block.BlockNumber-last.BlockNumber <= f.MaxGap {
+		for n := last.BlockNumber + 1; n < block.BlockNumber; n++ {
+			missed, err := f.Client.GetBlockWithTxHashes(ctx, BlockNumberId(n))
+			if err != nil {
+				return err
+			}
+			f.publish(missed.BlockHeader)
+		}
+	}
+	f.publish(block.BlockHeader)
+	return nil
+}
+
+type newHeadsNotification struct {
+	Method string `json:"method"`
+	Params struct {
+		SubscriptionId json.RawMessage `json:"subscription_id"`
+		Result         BlockHeader     `json:"result"`
+	} `json:"params"`
+}
+
+// subscribe streams headers from starknet_subscribeNewHeads until the connection fails
+func (f *HeadFeed) subscribe(ctx context.Context) error {
+	config, err := websocket.NewConfig(f.WsUrl, "http://localhost")
+	if err != nil {
+		return err
+	}
+	ws, err := config.DialContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+	stop := context.AfterFunc(ctx, func() { ws.Close() })
+	defer stop()
+
+	if err := websocket.JSON.Send(ws, newRpcRequest(1, "starknet_subscribeNewHeads", map[string]any{})); err != nil {
+		return err
+	}
+	var response rpcResponse
+	if err := websocket.JSON.Receive(ws, &response); err != nil {
+		return err
+	}
+	if err := response.decode("starknet_subscribeNewHeads", nil); err != nil {
+		return err
+	}
+	slog.Info("subscribed to new heads", "endpoint", f.WsUrl, "subscription", string(response.Result))
+
+	for {
+		var notification newHeadsNotification
+		if err := websocket.JSON.Receive(ws, &notification); err != nil {
+			return err
+		}
+		if notification.Method != "starknet_subscriptionNewHeads" {
+			continue
+		}
+		f.publish(notification.Params.Result)
+	}
+}
+
+// ReceiptClient fetches transaction receipts
+type ReceiptClient interface {
+	GetTransactionReceipt(ctx context.Context, hash *felt.Felt) (*TransactionReceipt, error)
+}
+
+// WaitForConfirmations returns the receipt of hash once its block is
+// confirmations blocks deep, the block including it counting as the first.
+// Reverted transactions are returned along with ErrTransactionReverted.
+func WaitForConfirmations(ctx context.Context, client ReceiptClient, feed *HeadFeed, hash *felt.Felt, confirmations uint64) (*TransactionReceipt, error) {
+	heads, unsubscribe := feed.Subscribe(1)
+	defer unsubscribe()
+
+	head := feed.Latest()
+	for {
+		if head != nil {
+			receipt, err := client.GetTransactionReceipt(ctx, hash)
+			switch {
+			case errors.Is(err, ErrTxnHashNotFound):
+			case err != nil:
+				return nil, err
+			case receipt.ExecutionStatus == "REVERTED":
+				return receipt, errors.Wrapf(ErrTransactionReverted, "%s: %s", hash, receipt.RevertReason)
+			case receipt.BlockHash != nil && head.BlockNumber+1 >= receipt.BlockNumber+confirmations:
+				return receipt, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case h := <-heads:
+			head = &h
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package starknet
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+	"golang.org/x/net/websocket"
+)
+
+type fakeHeads struct {
+	sync.Mutex
+	head uint64
+}
+
+func (c *fakeHeads) GetBlockWithTxHashes(ctx context.Context, blockId BlockId) (*BlockWithTxHashes, error) {
+	c.Lock()
+	defer c.Unlock()
+	n, ok := blockId.Number()
+	if blockId == BlockLatest {
+		n, ok = c.head, true
+	}
+	if !ok || n > c.head {
+		return nil, ErrBlockNotFound
+	}
+	return &BlockWithTxHashes{BlockHeader: BlockHeader{BlockNumber: n, BlockHash: FeltFromInt(int(1000 + n))}}, nil
+}
+
+func receive(t *testing.T, heads <-chan BlockHeader) BlockHeader {
+	t.Helper()
+	select {
+	case h := <-heads:
+		return h
+	case <-time.After(2 * time.Second):
+		t.Fatal("no header received")
+	}
+	return BlockHeader{}
+}
+
+func TestHeadFeedPollFillsGaps(t *testing.T) {
+	client := &fakeHeads{head: 10}
+	feed := NewHeadFeed(client, "")
+	heads, unsubscribe := feed.Subscribe(10)
+	defer unsubscribe()
+
+	for _, head := range []uint64{10, 10, 13} {
+		client.head = head
+		if err := feed.pollOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, expected := range []uint64{10, 11, 12, 13} {
+		if h := receive(t, heads); h.BlockNumber != expected {
+			t.Fatalf("expected block %d, got %d", expected, h.BlockNumber)
+		}
+	}
+	if len(heads) != 0 {
+		t.Fatal("the same head was published twice")
+	}
+}
+
+func TestHeadFeedWebsocket(t *testing.T) {
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		var req testRequest
+		if err := websocket.JSON.Receive(ws, &req); err != nil || req.Method != "starknet_subscribeNewHeads" {
+			t.Errorf("unexpected request %+v: %v", req, err)
+			return
+		}
+		_ = websocket.Message.Send(ws, `{"jsonrpc":"2.0","id":1,"result":"0x42"}`)
+		for n := 7; n < 9; n++ {
+			_ = websocket.Message.Send(ws, fmt.Sprintf(`{"jsonrpc":"2.0","method":"starknet_subscriptionNewHeads","params":{"subscription_id":"0x42","result":{"block_number":%d,"block_hash":"0x%x","parent_hash":"0x0","timestamp":0,"sequencer_address":"0x0","starknet_version":"0.13.2"}}}`, n, n))
+		}
+		// keep the subscription open until the client leaves
+		_, _ = ws.Read(make([]byte, 1))
+	}))
+	defer srv.Close()
+
+	feed := NewHeadFeed(&fakeHeads{}, "ws"+strings.TrimPrefix(srv.URL, "http"))
+	heads, unsubscribe := feed.Subscribe(10)
+	defer unsubscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- feed.Run(ctx) }()
+
+	if h := receive(t, heads); h.BlockNumber != 7 {
+		t.Fatalf("expected block 7, got %d", h.BlockNumber)
+	}
+	if h := receive(t, heads); !h.BlockHash.Equal(FeltFromInt(8)) {
+		t.Fatalf("unexpected header %+v", h)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+}
+
+type fakeReceipts map[string]*TransactionReceipt
+
+func (r fakeReceipts) GetTransactionReceipt(ctx context.Context, hash *felt.Felt) (*TransactionReceipt, error) {
+	receipt, ok := r[hash.String()]
+	if !ok {
+		return nil, ErrTxnHashNotFound
+	}
+	return receipt, nil
+}
+
+func TestWaitForConfirmations(t *testing.T) {
+	client := &fakeHeads{head: 100}
+	feed := NewHeadFeed(client, "")
+	receipts := fakeReceipts{
+		"0xa": {ExecutionStatus: "SUCCEEDED", BlockHash: FeltFromInt(1), BlockNumber: 101},
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := WaitForConfirmations(context.Background(), receipts, feed, FeltFromInt(0xa), 3)
+		done <- err
+	}()
+	for head := uint64(100); head <= 103; head++ {
+		client.head = head
+		if err := feed.pollOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-done:
+			if err != nil || head != 103 {
+				t.Fatalf("confirmed at block %d: %v", head, err)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	t.Fatal("transaction was never confirmed")
+}
+
+func TestWaitForConfirmationsReverted(t *testing.T) {
+	feed := NewHeadFeed(&fakeHeads{}, "")
+	feed.publish(BlockHeader{BlockNumber: 101, BlockHash: FeltFromInt(1)})
+	receipts := fakeReceipts{"0xb": {ExecutionStatus: "REVERTED", BlockHash: FeltFromInt(1), BlockNumber: 101, RevertReason: "not your turn"}}
+
+	_, err := WaitForConfirmations(context.Background(), receipts, feed, FeltFromInt(0xb), 1)
+	if !errors.Is(err, ErrTransactionReverted) {
+		t.Fatalf("expected ErrTransactionReverted, got %v", err)
+	}
+}
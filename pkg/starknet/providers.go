@@ -0,0 +1,228 @@
+package starknet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+)
+
+var (
+	ErrNoEndpoint        = errors.New("no rpc endpoint configured")
+	ErrChainIdMismatch   = errors.New("rpc endpoint is on another chain")
+	ErrNoHealthyEndpoint = errors.New("no healthy rpc endpoint")
+)
+
+// Provider is a JSON-RPC endpoint serving a network
+type Provider struct {
+	Url    string `json:"url"`
+	ApiKey string `json:"api_key,omitempty"`
+}
+
+// DefaultProviders of each network, the Nethermind ones need an api key
+func DefaultProviders(network StarknetNetwork, nethermindApiKey string) ([]Provider, error) {
+	switch network {
+	case Mainnet:
+		return []Provider{
+			{Url: "https://rpc.nethermind.io/mainnet-juno", ApiKey: nethermindApiKey},
+			{Url: "https://starknet-mainnet.public.blastapi.io/rpc/v0_7"},
+		}, nil
+	case Sepolia:
+		return []Provider{
+			{Url: "https://rpc.nethermind.io/sepolia-juno", ApiKey: nethermindApiKey},
+			{Url: "https://starknet-sepolia.public.blastapi.io/rpc/v0_7"},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown network %s", network)
+}
+
+// ChainId expected from the endpoints of a network
+func ChainId(network StarknetNetwork) (*felt.Felt, error) {
+	switch network {
+	case Mainnet:
+		return new(felt.Felt).SetBytes([]byte("SN_MAIN")), nil
+	case Sepolia:
+		return new(felt.Felt).SetBytes([]byte("SN_SEPOLIA")), nil
+	}
+	return nil, fmt.Errorf("unknown network %s", network)
+}
+
+func NewClientForNetwork(network StarknetNetwork, nethermindApiKey string) (*JsonRpcStarknetClient, error) {
+	providers, err := DefaultProviders(network, nethermindApiKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewJsonRpcStarknetClientWithProviders(network, providers...), nil
+}
+
+// NewClientFromEnv creates a client for NETWORK (mainnet by default). Endpoints
+// are read from the comma separated RPC_ENDPOINTS, or the network defaults.
+// An entry carries its own api key as url|key, RPC_API_KEY is only sent to the
+// Nethermind endpoints.
+func NewClientFromEnv() (*JsonRpcStarknetClient, error) {
+	network := StarknetNetwork(os.Getenv("NETWORK"))
+	if network == "" {
+		network = Mainnet
+	}
+	if _, err := ChainId(network); err != nil {
+		return nil, err
+	}
+	apiKey := os.Getenv("RPC_API_KEY")
+
+	endpoints := strings.TrimSpace(os.Getenv("RPC_ENDPOINTS"))
+	if endpoints == "" {
+		return NewClientForNetwork(network, apiKey)
+	}
+	var providers []Provider
+	for _, entry := range strings.Split(endpoints, ",") {
+		rawUrl, key, hasKey := strings.Cut(strings.TrimSpace(entry), "|")
+		if rawUrl = strings.TrimSpace(rawUrl); rawUrl == "" {
+			continue
+		}
+		p := Provider{Url: rawUrl, ApiKey: strings.TrimSpace(key)}
+		if !hasKey && isNethermind(rawUrl) {
+			p.ApiKey = apiKey
+		}
+		providers = append(providers, p)
+	}
+	if len(providers) == 0 {
+		return nil, ErrNoEndpoint
+	}
+	return NewJsonRpcStarknetClientWithProviders(network, providers...), nil
+}
+
+func isNethermind(rawUrl string) bool {
+	u, err := url.Parse(rawUrl)
+	return err == nil && u.Hostname() == "rpc.nethermind.io"
+}
+
+// Endpoint tracks the health of a provider
+type Endpoint struct {
+	Provider
+	Breaker *CircuitBreaker
+
+	unhealthy atomic.Bool
+}
+
+func newEndpoint(p Provider) *Endpoint {
+	return &Endpoint{Provider: p, Breaker: NewCircuitBreaker(5, 30*time.Second)}
+}
+
+// Healthy reports whether the endpoint passed its last health check
+func (e *Endpoint) Healthy() bool {
+	return !e.unhealthy.Load()
+}
+
+// pick returns the next endpoint round robin, preferring healthy ones with a closed circuit
+func (c *JsonRpcStarknetClient) pick() (*Endpoint, error) {
+	n := uint64(len(c.Endpoints))
+	if n == 0 {
+		return nil, ErrNoEndpoint
+	}
+	start := c.nextEndpoint.Add(1) - 1
+	for _, requireHealthy := range []bool{true, false} {
+		for i := uint64(0); i < n; i++ {
+			e := c.Endpoints[(start+i)%n]
+			if requireHealthy && !e.Healthy() {
+				continue
+			}
+			if e.Breaker == nil || e.Breaker.Allow() == nil {
+				return e, nil
+			}
+		}
+	}
+	return nil, ErrCircuitOpen
+}
+
+// chainIdOf asks a single endpoint for its chain id, without failover
+func (c *JsonRpcStarknetClient) chainIdOf(ctx context.Context, e *Endpoint) (*felt.Felt, error) {
+	jsonBody, err := json.Marshal(newRpcRequest(c.nextId.Add(1), "starknet_chainId", []any{}))
+	if err != nil {
+		return nil, err
+	}
+	var chainId felt.Felt
+	err = c.attempt(ctx, e, "starknet_chainId", jsonBody, func(body []byte) error {
+		var response rpcResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			return errors.Mark(err, ErrUnexpectedResponse)
+		}
+		return response.decode("starknet_chainId", &chainId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &chainId, nil
+}
+
+// CheckHealth probes every endpoint and returns the failure of each unhealthy one.
+// An endpoint is healthy when it answers with the chain id of the client network.
+func (c *JsonRpcStarknetClient) CheckHealth(ctx context.Context) map[string]error {
+	expected, _ := ChainId(c.Network)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failures := make(map[string]error)
+	for _, e := range c.Endpoints {
+		wg.Add(1)
+		go func(e *Endpoint) {
+			defer wg.Done()
+			chainId, err := c.chainIdOf(ctx, e)
+			if err == nil && expected != nil && !chainId.Equal(expected) {
+				err = errors.Wrapf(ErrChainIdMismatch, "%s answered %s, expected %s", e.Url, chainId.ShortString(), expected.ShortString())
+			}
+			if err != nil {
+				mu.Lock()
+				failures[e.Url] = err
+				mu.Unlock()
+			}
+			if e.unhealthy.Swap(err != nil) != (err != nil) {
+				slog.Info("rpc endpoint health changed", "endpoint", e.Url, "healthy", err == nil, "error", err)
+			}
+		}(e)
+	}
+	wg.Wait()
+	return failures
+}
+
+// VerifyChainId is meant to run at startup, it fails when an endpoint serves
+// another chain or when none of them is reachable.
+func (c *JsonRpcStarknetClient) VerifyChainId(ctx context.Context) error {
+	failures := c.CheckHealth(ctx)
+	for _, err := range failures {
+		if errors.Is(err, ErrChainIdMismatch) {
+			return err
+		}
+	}
+	if len(failures) == len(c.Endpoints) {
+		return errors.Wrapf(ErrNoHealthyEndpoint, "%d endpoints failed", len(failures))
+	}
+	for url, err := range failures {
+		slog.Warn("rpc endpoint unreachable", "endpoint", url, "error", err)
+	}
+	return nil
+}
+
+// StartHealthChecks probes the endpoints every interval until ctx is done
+func (c *JsonRpcStarknetClient) StartHealthChecks(ctx context.Context, interval time.Duration) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				c.CheckHealth(ctx)
+			}
+		}
+	}()
+}
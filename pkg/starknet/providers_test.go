@@ -0,0 +1,85 @@
+package starknet
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+func TestFailoverToNextEndpoint(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(down.Close)
+	up := newTestNode(t, map[string]func(json.RawMessage) string{
+		"starknet_blockNumber": static(`42`),
+	})
+
+	c := NewJsonRpcStarknetClientWithProviders(Mainnet, Provider{Url: down.URL}, up.Endpoints[0].Provider)
+	c.Retry = RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	for i := 0; i < 4; i++ {
+		n, err := c.BlockNumber(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 42 {
+			t.Fatalf("expected 42, got %d", n)
+		}
+	}
+}
+
+func TestVerifyChainId(t *testing.T) {
+	mainnet := newTestNode(t, map[string]func(json.RawMessage) string{
+		"starknet_chainId": static(`"0x534e5f4d41494e"`),
+	})
+	sepolia := newTestNode(t, map[string]func(json.RawMessage) string{
+		"starknet_chainId": static(`"0x534e5f5345504f4c4941"`),
+	})
+
+	c := NewJsonRpcStarknetClientWithProviders(Mainnet, mainnet.Endpoints[0].Provider)
+	if err := c.VerifyChainId(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	c = NewJsonRpcStarknetClientWithProviders(Mainnet, mainnet.Endpoints[0].Provider, sepolia.Endpoints[0].Provider)
+	if err := c.VerifyChainId(context.Background()); !errors.Is(err, ErrChainIdMismatch) {
+		t.Fatalf("expected chain id mismatch, got %v", err)
+	}
+	if c.Endpoints[1].Healthy() {
+		t.Fatal("sepolia endpoint should be unhealthy")
+	}
+}
+
+func TestNewClientFromEnv(t *testing.T) {
+	t.Setenv("NETWORK", "sepolia")
+	t.Setenv("RPC_ENDPOINTS", "http://a.example|a-secret, http://b.example, https://rpc.nethermind.io/sepolia-juno")
+	t.Setenv("RPC_API_KEY", "secret")
+
+	c, err := NewClientFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Network != Sepolia || len(c.Endpoints) != 3 {
+		t.Fatalf("unexpected client %s with %d endpoints", c.Network, len(c.Endpoints))
+	}
+	// keys are per endpoint, RPC_API_KEY only goes to Nethermind
+	for i, expected := range []Provider{
+		{Url: "http://a.example", ApiKey: "a-secret"},
+		{Url: "http://b.example"},
+		{Url: "https://rpc.nethermind.io/sepolia-juno", ApiKey: "secret"},
+	} {
+		if c.Endpoints[i].Provider != expected {
+			t.Fatalf("unexpected endpoint %d %+v", i, c.Endpoints[i].Provider)
+		}
+	}
+
+	t.Setenv("NETWORK", "goerli")
+	if _, err := NewClientFromEnv(); err == nil {
+		t.Fatal("expected unknown network error")
+	}
+}
@@ -0,0 +1,170 @@
+package starknet
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+type (
+	BlockHeader struct {
+		BlockHash        *felt.Felt `json:"block_hash,omitempty"`
+		ParentHash       *felt.Felt `json:"parent_hash"`
+		BlockNumber      uint64     `json:"block_number,omitempty"`
+		NewRoot          *felt.Felt `json:"new_root,omitempty"`
+		Timestamp        uint64     `json:"timestamp"`
+		SequencerAddress *felt.Felt `json:"sequencer_address"`
+		StarknetVersion  string     `json:"starknet_version"`
+	}
+	BlockWithTxHashes struct {
+		BlockHeader
+		// Empty for pending blocks
+		Status       string       `json:"status,omitempty"`
+		Transactions []*felt.Felt `json:"transactions"`
+	}
+	Event struct {
+		FromAddress *felt.Felt   `json:"from_address"`
+		Keys        []*felt.Felt `json:"keys"`
+		Data        []*felt.Felt `json:"data"`
+	}
+	EmittedEvent struct {
+		Event
+		BlockHash       *felt.Felt `json:"block_hash,omitempty"`
+		BlockNumber     uint64     `json:"block_number,omitempty"`
+		TransactionHash *felt.Felt `json:"transaction_hash"`
+	}
+	EventFilter struct {
+		FromBlock BlockId    `json:"from_block,omitempty"`
+		ToBlock   BlockId    `json:"to_block,omitempty"`
+		Address   *felt.Felt `json:"address,omitempty"`
+		// Keys[i] lists the accepted values for the i-th key, an empty list matches anything
+		Keys              [][]*felt.Felt `json:"keys,omitempty"`
+		ChunkSize         int            `json:"chunk_size"`
+		ContinuationToken string         `json:"continuation_token,omitempty"`
+	}
+	EventsChunk struct {
+		Events            []EmittedEvent `json:"events"`
+		ContinuationToken string         `json:"continuation_token,omitempty"`
+	}
+	MessageToL1 struct {
+		FromAddress *felt.Felt   `json:"from_address"`
+		ToAddress   *felt.Felt   `json:"to_address"`
+		Payload     []*felt.Felt `json:"payload"`
+	}
+	FeePayment struct {
+		Amount *felt.Felt `json:"amount"`
+		Unit   string     `json:"unit"`
+	}
+	TransactionReceipt struct {
+		Type            string        `json:"type"`
+		TransactionHash *felt.Felt    `json:"transaction_hash"`
+		ActualFee       FeePayment    `json:"actual_fee"`
+		ExecutionStatus string        `json:"execution_status"`
+		FinalityStatus  string        `json:"finality_status"`
+		BlockHash       *felt.Felt    `json:"block_hash,omitempty"`
+		BlockNumber     uint64        `json:"block_number,omitempty"`
+		MessagesSent    []MessageToL1 `json:"messages_sent"`
+		RevertReason    string        `json:"revert_reason,omitempty"`
+		Events          []Event       `json:"events"`
+		ContractAddress *felt.Felt    `json:"contract_address,omitempty"`
+	}
+)
+
+// Nodes before rpc v0.7 report the fee as a bare felt in wei
+func (f *FeePayment) UnmarshalJSON(b []byte) error {
+	var amount felt.Felt
+	if err := amount.UnmarshalJSON(b); err == nil {
+		f.Amount = &amount
+		f.Unit = "WEI"
+		return nil
+	}
+	type feePayment FeePayment
+	return json.Unmarshal(b, (*feePayment)(f))
+}
+
+type (
+	blockIdParams struct {
+		BlockId BlockId `json:"block_id"`
+	}
+	contractParams struct {
+		BlockId         BlockId    `json:"block_id"`
+		ContractAddress *felt.Felt `json:"contract_address"`
+	}
+	storageParams struct {
+		ContractAddress *felt.Felt `json:"contract_address"`
+		Key             *felt.Felt `json:"key"`
+		BlockId         BlockId    `json:"block_id"`
+	}
+	transactionParams struct {
+		TransactionHash *felt.Felt `json:"transaction_hash"`
+	}
+	eventsParams struct {
+		Filter EventFilter `json:"filter"`
+	}
+)
+
+// BlockNumber returns the number of the latest accepted block
+func (c *JsonRpcStarknetClient) BlockNumber(ctx context.Context) (uint64, error) {
+	var number uint64
+	err := c.do(ctx, "starknet_blockNumber", []any{}, &number)
+	return number, err
+}
+
+func (c *JsonRpcStarknetClient) ChainId(ctx context.Context) (*felt.Felt, error) {
+	var chainId felt.Felt
+	if err := c.do(ctx, "starknet_chainId", []any{}, &chainId); err != nil {
+		return nil, err
+	}
+	return &chainId, nil
+}
+
+func (c *JsonRpcStarknetClient) GetBlockWithTxHashes(ctx context.Context, blockId BlockId) (*BlockWithTxHashes, error) {
+	var block BlockWithTxHashes
+	if err := c.do(ctx, "starknet_getBlockWithTxHashes", blockIdParams{BlockId: blockId}, &block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+func (c *JsonRpcStarknetClient) GetStorageAt(ctx context.Context, address *felt.Felt, key *felt.Felt, blockId BlockId) (*felt.Felt, error) {
+	var value felt.Felt
+	if err := c.do(ctx, "starknet_getStorageAt", storageParams{ContractAddress: address, Key: key, BlockId: blockId}, &value); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+func (c *JsonRpcStarknetClient) GetNonce(ctx context.Context, address *felt.Felt, blockId BlockId) (*felt.Felt, error) {
+	var nonce felt.Felt
+	if err := c.do(ctx, "starknet_getNonce", contractParams{BlockId: blockId, ContractAddress: address}, &nonce); err != nil {
+		return nil, err
+	}
+	return &nonce, nil
+}
+
+func (c *JsonRpcStarknetClient) GetClassHashAt(ctx context.Context, address *felt.Felt, blockId BlockId) (*felt.Felt, error) {
+	var classHash felt.Felt
+	if err := c.do(ctx, "starknet_getClassHashAt", contractParams{BlockId: blockId, ContractAddress: address}, &classHash); err != nil {
+		return nil, err
+	}
+	return &classHash, nil
+}
+
+func (c *JsonRpcStarknetClient) GetTransactionReceipt(ctx context.Context, hash *felt.Felt) (*TransactionReceipt, error) {
+	var receipt TransactionReceipt
+	if err := c.do(ctx, "starknet_getTransactionReceipt", transactionParams{TransactionHash: hash}, &receipt); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// GetEvents returns one chunk of events, pass the continuation token back in
+// the filter to fetch the next one.
+func (c *JsonRpcStarknetClient) GetEvents(ctx context.Context, filter EventFilter) (*EventsChunk, error) {
+	var chunk EventsChunk
+	if err := c.do(ctx, "starknet_getEvents", eventsParams{Filter: filter}, &chunk); err != nil {
+		return nil, err
+	}
+	return &chunk, nil
+}
@@ -0,0 +1,83 @@
+package starknet
+
+import (
+	"context"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+type RetryPolicy struct {
+	// Total attempts including the first one
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+// delay returns the wait before the given retry, a Retry-After hint from the
+// endpoint takes precedence over the jittered exponential backoff
+func (p RetryPolicy) delay(attempt int, err error) time.Duration {
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) && httpErr.RetryAfter > 0 {
+		return min(httpErr.RetryAfter, p.MaxDelay)
+	}
+	d := p.BaseDelay << (attempt - 1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	// equal jitter, keeps at least half of the backoff
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryable errors are transient, the same request may succeed later
+func retryable(err error) bool {
+	if errors.IsAny(err, ErrRateLimited, ErrUnavailable, ErrInternal, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// IsRetryable tells whether err is transient. JsonRpcStarknetClient already
+// retried such errors on every endpoint according to its RetryPolicy.
+func IsRetryable(err error) bool {
+	return retryable(err)
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an http date
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,199 @@
+package starknet
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+func TestRetryHonoursRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":7}`))
+	}))
+	defer srv.Close()
+
+	c := NewJsonRpcStarknetClient(srv.URL)
+	c.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 20 * time.Millisecond}
+
+	start := time.Now()
+	n, err := c.BlockNumber(context.Background())
+	if err != nil || n != 7 {
+		t.Fatalf("unexpected %d, %v", n, err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("expected 2 calls, got %d", calls.Load())
+	}
+	// Retry-After is capped by MaxDelay
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("unexpected wait %s", elapsed)
+	}
+}
+
+func TestTimeoutPerAttempt(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	c := NewJsonRpcStarknetClient(srv.URL)
+	c.Timeout = 20 * time.Millisecond
+	c.Retry = RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	_, err := c.BlockNumber(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("expected 2 attempts, got %d", calls.Load())
+	}
+
+	// a cancelled caller is not retried
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls.Store(0)
+	if _, err := c.BlockNumber(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+	if calls.Load() != 0 {
+		t.Fatalf("expected no attempt, got %d", calls.Load())
+	}
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	c := NewJsonRpcStarknetClient(srv.URL)
+	c.Retry = RetryPolicy{MaxAttempts: 1}
+	breaker := NewCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+	c.Endpoints[0].Breaker = breaker
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.BlockNumber(context.Background()); !errors.Is(err, ErrUnavailable) {
+			t.Fatalf("expected ErrUnavailable, got %v", err)
+		}
+	}
+	if _, err := c.BlockNumber(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("open circuit should not reach the endpoint, got %d calls", calls.Load())
+	}
+
+	// after the cooldown a single probe goes through
+	now = now.Add(time.Minute)
+	if _, err := c.BlockNumber(context.Background()); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected probe to reach the endpoint, got %v", err)
+	}
+	if _, err := c.BlockNumber(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("failed probe should reopen the circuit, got %v", err)
+	}
+}
+
+func TestBreakerOnlyClosesOnSuccess(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":32,"message":"no blocks"}}`))
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	c := NewJsonRpcStarknetClient(srv.URL)
+	c.Retry = RetryPolicy{MaxAttempts: 1}
+	breaker := NewCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+	c.Endpoints[0].Breaker = breaker
+
+	for i := 0; i < 2; i++ {
+		_, _ = c.BlockNumber(context.Background())
+	}
+	now = now.Add(time.Minute)
+
+	// a probe answered with an rpc error leaves the circuit half open
+	if _, err := c.BlockNumber(context.Background()); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the probe to reach the endpoint, got %v", err)
+	}
+	if !breaker.Open() {
+		t.Fatal("an rpc error should not close the circuit")
+	}
+	if _, err := c.BlockNumber(context.Background()); errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("the next probe should be let in")
+	}
+
+	// neither does a cancelled call
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _ = c.BlockNumber(ctx)
+	if !breaker.Open() {
+		t.Fatal("a cancelled call should not close the circuit")
+	}
+}
+
+func TestBackoffAfterFailingOverEveryEndpoint(t *testing.T) {
+	var calls atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	providers := make([]Provider, 3)
+	for i := range providers {
+		srv := httptest.NewServer(handler)
+		defer srv.Close()
+		providers[i] = Provider{Url: srv.URL}
+	}
+
+	// more endpoints than attempts, each attempt still tries them all
+	c := NewJsonRpcStarknetClientWithProviders(Mainnet, providers...)
+	c.Retry = RetryPolicy{MaxAttempts: 2, BaseDelay: 20 * time.Millisecond, MaxDelay: 20 * time.Millisecond}
+
+	start := time.Now()
+	if _, err := c.BlockNumber(context.Background()); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+	if calls.Load() != 6 {
+		t.Fatalf("expected 6 calls, got %d", calls.Load())
+	}
+	// the jitter keeps at least half of the backoff
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Fatalf("expected a backoff between attempts, waited %s", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	if d := parseRetryAfter("3", now); d != 3*time.Second {
+		t.Fatalf("unexpected %s", d)
+	}
+	if d := parseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now); d != time.Minute {
+		t.Fatalf("unexpected %s", d)
+	}
+	if d := parseRetryAfter("soon", now); d != 0 {
+		t.Fatalf("unexpected %s", d)
+	}
+}
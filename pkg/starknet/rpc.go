@@ -2,14 +2,28 @@ package starknet
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/MartianGreed/memo-backend/pkg/metrics"
+	"github.com/MartianGreed/memo-backend/pkg/tracing"
 )
 
 type (
@@ -22,174 +36,357 @@ const (
 	BlockPending BlockId = "pending"
 
 	Mainnet StarknetNetwork = "mainnet"
-	Goerli  StarknetNetwork = "goerli"
 	Sepolia StarknetNetwork = "sepolia"
 )
 
+// BlockNumberId identifies a block by its number
+func BlockNumberId(n uint64) BlockId {
+	return BlockId(strconv.FormatUint(n, 10))
+}
+
+// BlockHashId identifies a block by its hash
+func BlockHashId(hash *felt.Felt) BlockId {
+	return BlockId(hash.String())
+}
+
+// ParseBlockId reads a tag, a decimal block number or a 0x prefixed block hash
+func ParseBlockId(s string) (BlockId, error) {
+	switch b := BlockId(s); {
+	case b == BlockLatest || b == BlockPending:
+		return b, nil
+	case strings.HasPrefix(s, "0x"):
+		hash, err := new(felt.Felt).SetString(s)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid block hash %s", s)
+		}
+		return BlockHashId(hash), nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return "", errors.Newf("invalid block id %q", s)
+	}
+	return BlockNumberId(n), nil
+}
+
+func (b BlockId) Number() (uint64, bool) {
+	n, err := strconv.ParseUint(string(b), 10, 64)
+	return n, err == nil
+}
+
+func (b BlockId) Hash() (*felt.Felt, bool) {
+	if !strings.HasPrefix(string(b), "0x") {
+		return nil, false
+	}
+	hash, err := new(felt.Felt).SetString(string(b))
+	return hash, err == nil
+}
+
+// tags are sent as is, numbers and hashes as block_number and block_hash objects
+func (b BlockId) MarshalJSON() ([]byte, error) {
+	if n, ok := b.Number(); ok {
+		return json.Marshal(map[string]uint64{"block_number": n})
+	}
+	if hash, ok := b.Hash(); ok {
+		return json.Marshal(map[string]*felt.Felt{"block_hash": hash})
+	}
+	return json.Marshal(string(b))
+}
+
 type StarknetRpcClient interface {
-	Call(address string, method string, params []felt.Felt) ([]felt.Felt, error)
+	Call(ctx context.Context, address string, method string, params []felt.Felt) ([]felt.Felt, error)
 }
 
 type JsonRpcStarknetClient struct {
-	Client   *http.Client
-	Endpoint string
+	Client  *http.Client
+	Network StarknetNetwork
+	// Requests are spread round robin over the endpoints and fail over to the next one
+	Endpoints []*Endpoint
+	// Deadline of a single attempt, zero disables it
+	Timeout time.Duration
+	Retry   RetryPolicy
+
+	nextId       atomic.Uint64
+	nextEndpoint atomic.Uint64
 }
 
-func (c *JsonRpcStarknetClient) Call(address string, method string, params []felt.Felt) ([]felt.Felt, error) {
-	req := newRpcRequest("starknet_call", newCallRequestParams(address, method, params, BlockLatest))
-	jsonBody, err := json.Marshal(req)
+func (c *JsonRpcStarknetClient) Call(ctx context.Context, address string, method string, params []felt.Felt) ([]felt.Felt, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "starknet.Call", trace.WithAttributes(
+		attribute.String("starknet.contract_address", address),
+		attribute.String("starknet.entry_point", method),
+	))
+	var result []felt.Felt
+	err := c.do(ctx, "starknet_call", newCallRequestParams(address, method, params, BlockLatest), &result)
+	tracing.End(span, err)
+	return result, err
+}
+
+// do sends a json rpc request, retrying transient failures, and decodes its result into out
+func (c *JsonRpcStarknetClient) do(ctx context.Context, method string, params any, out any) error {
+	jsonBody, err := json.Marshal(newRpcRequest(c.nextId.Add(1), method, params))
 	if err != nil {
-		return nil, err
+		return err
 	}
-	request, err := http.NewRequest("POST", c.Endpoint, bytes.NewBuffer(jsonBody))
+	return c.send(ctx, method, jsonBody, func(body []byte) error {
+		var response rpcResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			slog.Error(err.Error())
+			return errors.Mark(err, ErrUnexpectedResponse)
+		}
+		return response.decode(method, out)
+	})
+}
+
+// send posts jsonBody and hands the response body to decode, the whole
+// exchange is retried while it fails with a transient error
+func (c *JsonRpcStarknetClient) send(ctx context.Context, label string, jsonBody []byte, decode func(body []byte) error, attrs ...attribute.KeyValue) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, label, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("rpc.system", "jsonrpc"),
+		attribute.String("rpc.method", label),
+	), trace.WithAttributes(attrs...))
+	defer func() { tracing.End(span, err) }()
+
+	// an attempt tries every endpoint once, failing over without delay, only
+	// then the client backs off before the next attempt
+	attempts := max(c.Retry.MaxAttempts, 1)
+	hops := 0
+	for attempt := 1; ; {
+		endpoint, err := c.pick()
+		if err != nil {
+			return errors.Wrapf(err, "%s", label)
+		}
+
+		err = c.attempt(ctx, endpoint, label, jsonBody, decode)
+		if endpoint.Breaker != nil {
+			switch {
+			case err == nil:
+				endpoint.Breaker.Success()
+			case retryable(err) && ctx.Err() == nil:
+				endpoint.Breaker.Failure()
+			default:
+				// says nothing about the endpoint health
+				endpoint.Breaker.Release()
+			}
+		}
+		if err == nil || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+
+		if hops++; hops < len(c.Endpoints) {
+			slog.Warn("failing over rpc call", "method", label, "endpoint", endpoint.Url, "error", err)
+			span.AddEvent("failover", trace.WithAttributes(attribute.String("server.address", endpointHost(endpoint.Url))))
+			continue
+		}
+		if attempt >= attempts {
+			return err
+		}
+		delay := c.Retry.delay(attempt, err)
+		span.AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempt), attribute.String("delay", delay.String())))
+		slog.Warn("retrying rpc call", "method", label, "attempt", attempt, "delay", delay, "error", err)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+		attempt++
+		hops = 0
+	}
+}
+
+func (c *JsonRpcStarknetClient) attempt(ctx context.Context, endpoint *Endpoint, label string, jsonBody []byte, decode func(body []byte) error) (err error) {
+	start := time.Now()
+	defer func() { metrics.RpcCalls.WithLabelValues(label, callStatus(err)).Observe(time.Since(start).Seconds()) }()
+	// only the host is recorded, some providers put the api key in the path
+	ctx, span := tracing.Tracer().Start(ctx, "attempt "+label, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("server.address", endpointHost(endpoint.Url))))
+	defer func() { tracing.End(span, err) }()
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", endpoint.Url, bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	request.Header.Add("x-apikey", os.Getenv("RPC_API_KEY"))
+	request.Header.Add("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(request.Header))
+	if endpoint.ApiKey != "" {
+		request.Header.Add("x-apikey", endpoint.ApiKey)
+	}
 
 	resp, err := c.Client.Do(request)
 	if err != nil {
 		slog.Error(err.Error())
-		return nil, err
+		return err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		slog.Error(err.Error())
-		return nil, err
+		return err
 	}
 
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 	if resp.StatusCode != 200 {
-		slog.Error(fmt.Sprintf("http status code : %d", resp.StatusCode))
-		slog.Error(fmt.Sprintf("response body : %s", body))
-		return nil, fmt.Errorf("%s", resp.Status)
-	}
-
-	var response rpcResponse
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		slog.Error(err.Error())
-		return nil, err
+		slog.Error(fmt.Sprintf("http status code : %d", resp.StatusCode), "method", label, "endpoint", endpoint.Url)
+		return newHttpError(resp, body)
 	}
 
-	return response.Result, nil
+	return decode(body)
 }
 
-func GetTokenUri(rpc StarknetRpcClient, address string, tokenId int) (string, error) {
-	res, err := rpc.Call(address, "token_uri", []felt.Felt{*FeltFromInt(tokenId), *Zero})
+func endpointHost(endpoint string) string {
+	u, err := url.Parse(endpoint)
 	if err != nil {
-		return "", err
+		return endpoint
 	}
-	if len(res) == 0 {
-		return "", fmt.Errorf("token %d not minted yet", tokenId)
+	return u.Host
+}
+
+// minimal ERC721 metadata interface, token_uri returns a ByteArray
+var erc721MetadataAbi = MustParseAbi(`[
+	{
+		"type": "function",
+		"name": "token_uri",
+		"inputs": [{"name": "token_id", "type": "core::integer::u256"}],
+		"outputs": [{"type": "core::byte_array::ByteArray"}],
+		"state_mutability": "view"
 	}
+]`)
 
-	uri := DecodeToString(res[1 : len(res)-1])
+func GetTokenUri(ctx context.Context, rpc StarknetRpcClient, address string, tokenId int) (string, error) {
+	calldata, err := erc721MetadataAbi.EncodeInputs("token_uri", tokenId)
 	if err != nil {
 		return "", err
 	}
-	return uri, nil
+	res, err := rpc.Call(ctx, address, "token_uri", calldata)
+	return decodeTokenUri(tokenId, res, err)
 }
 
-type client struct {
-	currentRequests chan interface{}
-	baseUrl         string
-}
-
-func newCLient(baseUrl string, maxRpm int) *client {
-	return &client{
-		baseUrl:         baseUrl,
-		currentRequests: make(chan interface{}, maxRpm),
+func decodeTokenUri(tokenId int, res []felt.Felt, err error) (string, error) {
+	if err != nil {
+		if reason, ok := RevertReason(err); ok {
+			return "", errors.Wrapf(err, "token_uri(%d) reverted: %s", tokenId, reason)
+		}
+		return "", err
 	}
+	uri, err := decodeTokenUriResult(res)
+	if err != nil {
+		return "", errors.Wrapf(err, "token_uri(%d)", tokenId)
+	}
+	return uri, nil
 }
 
-func (c *client) Get(path string) ([]byte, error) {
-	donech := make(chan []byte)
-	errch := make(chan error)
+// encodings of token_uri, the abi declares a ByteArray but older contracts
+// return an Array<felt252> of short strings or a single short string
+var tokenUriTypes = []string{typeByteArray, typeArray + "::<core::felt252>", "core::felt252"}
 
-	go func() { c.currentRequests <- true }()
-	go func() {
-		resp, err := http.Get(fmt.Sprintf("%s/%s", c.baseUrl, path))
-		if err != nil {
-			errch <- err
-			return
+// decodeTokenUriResult returns the uri of the first encoding spanning the whole result
+func decodeTokenUriResult(res []felt.Felt) (string, error) {
+	for _, typ := range tokenUriTypes {
+		v, n, err := erc721MetadataAbi.Decode(typ, res)
+		if err != nil || n != len(res) {
+			continue
 		}
-
-		defer resp.Body.Close()
-
-		if resp.StatusCode != 200 {
-			errch <- fmt.Errorf("invalid status code %d", resp.StatusCode)
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case *felt.Felt:
+			if uri, err := DecodeShortString(v); err == nil {
+				return uri, nil
+			}
+		case []any:
+			if uri, err := joinShortStrings(v); err == nil {
+				return uri, nil
+			}
 		}
+	}
+	return "", errors.Wrapf(ErrUnexpectedResponse, "%d felts match no token uri encoding", len(res))
+}
 
-		body, err := io.ReadAll(resp.Body)
+func joinShortStrings(words []any) (string, error) {
+	var b strings.Builder
+	for _, word := range words {
+		s, err := DecodeShortString(word.(*felt.Felt))
 		if err != nil {
-			errch <- err
+			return "", err
 		}
-		donech <- body
-	}()
-
-	select {
-	case body := <-donech:
-		<-c.currentRequests
-		return body, nil
-	case err := <-errch:
-		<-c.currentRequests
-		return []byte(""), err
+		b.WriteString(s)
 	}
+	return b.String(), nil
 }
 
+// NewJsonRpcStarknetClient creates a client for a single endpoint
 func NewJsonRpcStarknetClient(endpoint string) *JsonRpcStarknetClient {
+	return NewJsonRpcStarknetClientWithProviders("", Provider{Url: endpoint})
+}
+
+func NewJsonRpcStarknetClientWithProviders(network StarknetNetwork, providers ...Provider) *JsonRpcStarknetClient {
+	var endpoints []*Endpoint
+	for _, p := range providers {
+		endpoints = append(endpoints, newEndpoint(p))
+	}
 	return &JsonRpcStarknetClient{
-		Endpoint: endpoint,
-		Client:   &http.Client{},
+		Client:    &http.Client{},
+		Network:   network,
+		Endpoints: endpoints,
+		Timeout:   10 * time.Second,
+		Retry:     DefaultRetryPolicy,
 	}
 }
 
 // Create mainnet json rpc client
 func MainnetJsonRpcStarknetClient() *JsonRpcStarknetClient {
-	return NewJsonRpcStarknetClient("https://rpc.nethermind.io/mainnet-juno")
-}
-
-// Create goerli json rpc client
-func GoerliJsonRpcStarknetClient() *JsonRpcStarknetClient {
-	return NewJsonRpcStarknetClient("https://rpc.nethermind.io/goerli-juno")
+	client, _ := NewClientForNetwork(Mainnet, os.Getenv("RPC_API_KEY"))
+	return client
 }
 
 // Create sepolia  json rpc client
 func SepoliaJsonRpcStarknetClient() *JsonRpcStarknetClient {
-	return NewJsonRpcStarknetClient("https://rpc.nethermind.io/sepolia-juno")
+	client, _ := NewClientForNetwork(Sepolia, os.Getenv("RPC_API_KEY"))
+	return client
 }
 
 type rpcRequest[T any] struct {
 	Params  T      `json:"params"`
 	JsonRpc string `json:"jsonrpc"`
 	Method  string `json:"method"`
-	Id      int8   `json:"id"`
+	Id      uint64 `json:"id"`
 }
 
-func newRpcRequest[T any](method string, params T) *rpcRequest[T] {
+func newRpcRequest[T any](id uint64, method string, params T) *rpcRequest[T] {
 	return &rpcRequest[T]{
 		Params:  params,
 		JsonRpc: "2.0",
 		Method:  method,
-		Id:      1,
+		Id:      id,
 	}
 }
 
 type rpcResponse struct {
-	JsonRpc string
-	Result  []felt.Felt
-	Id      int8
+	JsonRpc string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *RpcError       `json:"error,omitempty"`
+	// null when the server could not read the request id
+	Id *uint64 `json:"id"`
 }
 
-func newRpcResponse(result []felt.Felt) *rpcResponse {
-	return &rpcResponse{
-		JsonRpc: "2.0",
-		Result:  result,
-		Id:      1,
+func (r *rpcResponse) decode(method string, out any) error {
+	if r.Error != nil {
+		return errors.Wrapf(newRpcError(r.Error), "%s", method)
 	}
+	if out == nil {
+		return nil
+	}
+	if len(r.Result) == 0 {
+		return errors.Wrapf(ErrUnexpectedResponse, "%s: missing result", method)
+	}
+	if err := json.Unmarshal(r.Result, out); err != nil {
+		return errors.Mark(errors.Wrapf(err, "%s", method), ErrUnexpectedResponse)
+	}
+	return nil
 }
 
 type callRequest struct {
@@ -222,21 +419,3 @@ func newCallRequestParams(address string, method string, params []felt.Felt, blo
 		BlockId: blockId,
 	}
 }
-
-func FeltArrToBytesArr(feltArr []felt.Felt) []byte {
-	var bArr []byte
-	for _, f := range feltArr {
-		b := f.Marshal()
-		bArr = append(bArr, bytes.Trim(b[0:], "\x00")...)
-	}
-	return bArr
-}
-
-func DecodeToString(feltArr []felt.Felt) string {
-	var s string
-	for _, f := range feltArr {
-		b := f.Marshal()
-		s += string(bytes.Trim(b[0:], "\x00"))
-	}
-	return s
-}
@@ -0,0 +1,368 @@
+package starknet
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/MartianGreed/memo-backend/pkg/metrics"
+)
+
+type testRequest struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Id     int             `json:"id"`
+}
+
+// newTestNode answers json rpc requests with the raw result registered for their method
+func newTestNode(t *testing.T, results map[string]func(params json.RawMessage) string) *JsonRpcStarknetClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req testRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %v", err)
+			return
+		}
+		handler, ok := results[req.Method]
+		if !ok {
+			t.Errorf("unexpected method %s", req.Method)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + handler(req.Params) + `}`))
+	}))
+	t.Cleanup(srv.Close)
+	return NewJsonRpcStarknetClient(srv.URL)
+}
+
+func static(result string) func(json.RawMessage) string {
+	return func(json.RawMessage) string { return result }
+}
+
+func feltFromString(t *testing.T, s string) *felt.Felt {
+	t.Helper()
+	f, err := new(felt.Felt).SetString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestBlockNumberAndChainId(t *testing.T) {
+	c := newTestNode(t, map[string]func(json.RawMessage) string{
+		"starknet_blockNumber": static(`652312`),
+		"starknet_chainId":     static(`"0x534e5f4d41494e"`),
+	})
+
+	n, err := c.BlockNumber(context.Background())
+	if err != nil || n != 652312 {
+		t.Fatalf("unexpected block number %d, %v", n, err)
+	}
+	chainId, err := c.ChainId(context.Background())
+	if err != nil || !chainId.Equal(feltFromString(t, "0x534e5f4d41494e")) {
+		t.Fatalf("unexpected chain id %v, %v", chainId, err)
+	}
+}
+
+func TestGetBlockWithTxHashes(t *testing.T) {
+	c := newTestNode(t, map[string]func(json.RawMessage) string{
+		"starknet_getBlockWithTxHashes": func(params json.RawMessage) string {
+			if string(params) != `{"block_id":"latest"}` {
+				t.Errorf("unexpected params %s", params)
+			}
+			return `{"status":"ACCEPTED_ON_L2","block_hash":"0x1a","parent_hash":"0x19","block_number":10,"new_root":"0x2","timestamp":1700000000,"sequencer_address":"0x3","starknet_version":"0.13.1","transactions":["0xa","0xb"]}`
+		},
+	})
+
+	block, err := c.GetBlockWithTxHashes(context.Background(), BlockLatest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.BlockNumber != 10 || !block.BlockHash.Equal(feltFromString(t, "0x1a")) || len(block.Transactions) != 2 || block.Status != "ACCEPTED_ON_L2" {
+		t.Fatalf("unexpected block %+v", block)
+	}
+}
+
+func TestBlockIdJson(t *testing.T) {
+	for id, expected := range map[BlockId]string{
+		BlockLatest:                    `"latest"`,
+		BlockPending:                   `"pending"`,
+		BlockNumberId(65312):           `{"block_number":65312}`,
+		BlockHashId(FeltFromInt(0x1a)): `{"block_hash":"0x1a"}`,
+	} {
+		b, err := json.Marshal(id)
+		if err != nil || string(b) != expected {
+			t.Errorf("%s: expected %s, got %s %v", id, expected, b, err)
+		}
+	}
+
+	for s, expected := range map[string]BlockId{"latest": BlockLatest, "42": BlockNumberId(42), "0x01a": BlockHashId(FeltFromInt(0x1a))} {
+		if id, err := ParseBlockId(s); err != nil || id != expected {
+			t.Errorf("%s: expected %s, got %s %v", s, expected, id, err)
+		}
+	}
+	if _, err := ParseBlockId("head"); err == nil {
+		t.Error("expected invalid block id")
+	}
+}
+
+func TestContractState(t *testing.T) {
+	c := newTestNode(t, map[string]func(json.RawMessage) string{
+		"starknet_getStorageAt": func(params json.RawMessage) string {
+			if string(params) != `{"contract_address":"0x539","key":"0x5","block_id":"pending"}` {
+				t.Errorf("unexpected params %s", params)
+			}
+			return `"0x2a"`
+		},
+		"starknet_getNonce":       static(`"0x3"`),
+		"starknet_getClassHashAt": static(`"0x7e"`),
+	})
+	address := feltFromString(t, "0x539")
+
+	value, err := c.GetStorageAt(context.Background(), address, FeltFromInt(5), BlockPending)
+	if err != nil || value.Uint64() != 42 {
+		t.Fatalf("unexpected storage %v, %v", value, err)
+	}
+	nonce, err := c.GetNonce(context.Background(), address, BlockLatest)
+	if err != nil || nonce.Uint64() != 3 {
+		t.Fatalf("unexpected nonce %v, %v", nonce, err)
+	}
+	classHash, err := c.GetClassHashAt(context.Background(), address, BlockLatest)
+	if err != nil || classHash.Uint64() != 0x7e {
+		t.Fatalf("unexpected class hash %v, %v", classHash, err)
+	}
+}
+
+func TestGetTransactionReceipt(t *testing.T) {
+	c := newTestNode(t, map[string]func(json.RawMessage) string{
+		"starknet_getTransactionReceipt": static(`{"type":"INVOKE","transaction_hash":"0xabc","actual_fee":{"amount":"0x10","unit":"FRI"},"execution_status":"REVERTED","finality_status":"ACCEPTED_ON_L2","block_hash":"0x1","block_number":3,"messages_sent":[],"revert_reason":"Error in the called contract","events":[{"from_address":"0x539","keys":["0x1"],"data":["0x2","0x3"]}]}`),
+	})
+
+	receipt, err := c.GetTransactionReceipt(context.Background(), feltFromString(t, "0xabc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.ExecutionStatus != "REVERTED" || receipt.ActualFee.Unit != "FRI" || receipt.ActualFee.Amount.Uint64() != 16 || len(receipt.Events[0].Data) != 2 {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+
+	// pre v0.7 nodes report a bare fee
+	var legacy TransactionReceipt
+	if err := json.Unmarshal([]byte(`{"actual_fee":"0x20"}`), &legacy); err != nil || legacy.ActualFee.Amount.Uint64() != 32 {
+		t.Fatalf("unexpected legacy fee %+v, %v", legacy.ActualFee, err)
+	}
+}
+
+func TestGetEvents(t *testing.T) {
+	c := newTestNode(t, map[string]func(json.RawMessage) string{
+		"starknet_getEvents": func(params json.RawMessage) string {
+			var p eventsParams
+			if err := json.Unmarshal(params, &p); err != nil {
+				t.Errorf("invalid params %s", params)
+			}
+			if p.Filter.ContinuationToken == "" {
+				return `{"events":[{"from_address":"0x539","keys":["0x1"],"data":[],"block_hash":"0x5","block_number":5,"transaction_hash":"0x6"}],"continuation_token":"5-1"}`
+			}
+			return `{"events":[]}`
+		},
+	})
+
+	filter := EventFilter{FromBlock: BlockLatest, ToBlock: BlockLatest, Address: feltFromString(t, "0x539"), ChunkSize: 1}
+	chunk, err := c.GetEvents(context.Background(), filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunk.Events) != 1 || chunk.Events[0].BlockNumber != 5 || chunk.ContinuationToken != "5-1" {
+		t.Fatalf("unexpected chunk %+v", chunk)
+	}
+
+	filter.ContinuationToken = chunk.ContinuationToken
+	chunk, err = c.GetEvents(context.Background(), filter)
+	if err != nil || len(chunk.Events) != 0 || chunk.ContinuationToken != "" {
+		t.Fatalf("unexpected last chunk %+v, %v", chunk, err)
+	}
+}
+
+func newRawTestNode(t *testing.T, status int, body string) *JsonRpcStarknetClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	c := NewJsonRpcStarknetClient(srv.URL)
+	c.Retry = RetryPolicy{MaxAttempts: 1}
+	return c
+}
+
+func TestTypedRpcErrors(t *testing.T) {
+	c := newRawTestNode(t, http.StatusOK, `{"jsonrpc":"2.0","id":1,"error":{"code":40,"message":"Contract error","data":{"revert_error":"ERC721: invalid token ID"}}}`)
+	_, err := GetTokenUri(context.Background(), c, "0x539", 404)
+	if !errors.Is(err, ErrContractError) {
+		t.Fatalf("expected ErrContractError, got %v", err)
+	}
+	if reason, ok := RevertReason(err); !ok || reason != "ERC721: invalid token ID" {
+		t.Fatalf("unexpected revert reason %q", reason)
+	}
+
+	c = newRawTestNode(t, http.StatusOK, `{"jsonrpc":"2.0","id":1,"error":{"code":20,"message":"Contract not found"}}`)
+	_, err = c.GetNonce(context.Background(), FeltFromInt(1), BlockLatest)
+	if !errors.Is(err, ErrContractNotFound) || errors.Is(err, ErrContractError) {
+		t.Fatalf("expected ErrContractNotFound, got %v", err)
+	}
+	var rpcErr *RpcError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != 20 {
+		t.Fatalf("expected RpcError with code 20, got %v", err)
+	}
+
+	c = newRawTestNode(t, http.StatusOK, `{"jsonrpc":"2.0","id":1,"error":{"code":24,"message":"Block not found"}}`)
+	if _, err := c.GetBlockWithTxHashes(context.Background(), BlockLatest); !errors.Is(err, ErrBlockNotFound) {
+		t.Fatalf("expected ErrBlockNotFound, got %v", err)
+	}
+
+	c = newRawTestNode(t, http.StatusTooManyRequests, `slow down`)
+	if _, err := c.BlockNumber(context.Background()); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+
+	c = newRawTestNode(t, http.StatusBadGateway, `bad gateway`)
+	if _, err := c.BlockNumber(context.Background()); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+}
+
+func TestGetTokenUriRejectsMalformedResult(t *testing.T) {
+	c := newRawTestNode(t, http.StatusOK, `{"jsonrpc":"2.0","id":1,"result":["0x5","0x1"]}`)
+	if _, err := GetTokenUri(context.Background(), c, "0x539", 1); !errors.Is(err, ErrUnexpectedResponse) {
+		t.Fatalf("expected ErrUnexpectedResponse, got %v", err)
+	}
+}
+
+func TestGetTokenUriEncodings(t *testing.T) {
+	uri := "https://example.com/metadata/token/1.json"
+	short := func(s string) felt.Felt { return *new(felt.Felt).SetBytes([]byte(s)) }
+
+	for name, tc := range map[string]struct {
+		res      []felt.Felt
+		expected string
+	}{
+		"byte array":      {EncodeByteArray(uri), uri},
+		"felt252 array":   {[]felt.Felt{*FeltFromInt(2), short(uri[:31]), short(uri[31:])}, uri},
+		"short string":    {[]felt.Felt{short("ipfs://bafy/1")}, "ipfs://bafy/1"},
+		"empty array":     {[]felt.Felt{*FeltFromInt(0)}, ""},
+		"empty bytearray": {EncodeByteArray(""), ""},
+	} {
+		result, err := json.Marshal(tc.res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := newRawTestNode(t, http.StatusOK, `{"jsonrpc":"2.0","id":1,"result":`+string(result)+`}`)
+		got, err := GetTokenUri(context.Background(), c, "0x539", 1)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got != tc.expected {
+			t.Fatalf("%s: expected %q, got %q", name, tc.expected, got)
+		}
+	}
+
+	// a felt252 array whose words are not short strings is no uri
+	c := newRawTestNode(t, http.StatusOK, `{"jsonrpc":"2.0","id":1,"result":["0x1","0x800000000000011000000000000000000000000000000000000000000000000"]}`)
+	if _, err := GetTokenUri(context.Background(), c, "0x539", 1); !errors.Is(err, ErrUnexpectedResponse) {
+		t.Fatalf("expected ErrUnexpectedResponse, got %v", err)
+	}
+}
+
+func TestRpcCallMetrics(t *testing.T) {
+	calls := func(method string, status string) uint64 {
+		var m dto.Metric
+		if err := metrics.RpcCalls.WithLabelValues(method, status).(prometheus.Histogram).Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetHistogram().GetSampleCount()
+	}
+	batchSize := func() (uint64, float64) {
+		var m dto.Metric
+		if err := metrics.RpcBatchSize.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+	}
+	reverts, unavailable := calls("starknet_getNonce", "rpc_error"), calls("starknet_blockNumber", "502")
+	batches := calls("batch", "rpc_error")
+	batchCount, batchSum := batchSize()
+
+	c := newRawTestNode(t, http.StatusOK, `{"jsonrpc":"2.0","id":1,"error":{"code":20,"message":"Contract not found"}}`)
+	_, _ = c.GetNonce(context.Background(), FeltFromInt(1), BlockLatest)
+	c = newRawTestNode(t, http.StatusBadGateway, `bad gateway`)
+	_, _ = c.BlockNumber(context.Background())
+
+	if n := calls("starknet_getNonce", "rpc_error"); n != reverts+1 {
+		t.Fatalf("expected one more rpc_error call, got %d then %d", reverts, n)
+	}
+	if n := calls("starknet_blockNumber", "502"); n != unavailable+1 {
+		t.Fatalf("expected one more 502 call, got %d then %d", unavailable, n)
+	}
+
+	// batches share a single method label whatever their size
+	c = newRawTestNode(t, http.StatusOK, `{"jsonrpc":"2.0","id":null,"error":{"code":-32602,"message":"Invalid params"}}`)
+	_ = c.Batch(context.Background(), []*BatchCall{
+		{Method: "starknet_blockNumber", Params: []any{}},
+		{Method: "starknet_chainId", Params: []any{}},
+	})
+	if n := calls("batch", "rpc_error"); n != batches+1 {
+		t.Fatalf("expected one more batch call, got %d then %d", batches, n)
+	}
+	if count, sum := batchSize(); count != batchCount+1 || sum != batchSum+2 {
+		t.Fatalf("expected a batch of 2 to be observed, got %d batches of %v calls", count-batchCount, sum-batchSum)
+	}
+}
+
+func TestRpcCallSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":["0x1"]}`))
+	}))
+	t.Cleanup(srv.Close)
+	if _, err := NewJsonRpcStarknetClient(srv.URL).Call(context.Background(), "0x539", "balance_of", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	// children end first
+	attempt, send, call := spans[0], spans[1], spans[2]
+	if call.Name() != "starknet.Call" || send.Name() != "starknet_call" || attempt.Name() != "attempt starknet_call" {
+		t.Fatalf("unexpected spans %s, %s, %s", call.Name(), send.Name(), attempt.Name())
+	}
+	if send.Parent().SpanID() != call.SpanContext().SpanID() || attempt.Parent().SpanID() != send.SpanContext().SpanID() {
+		t.Fatal("expected the attempt to be nested in the request, nested in the call")
+	}
+	if !strings.Contains(traceparent, call.SpanContext().TraceID().String()) {
+		t.Fatalf("expected the trace to be propagated to the node, got %q", traceparent)
+	}
+}
@@ -0,0 +1,44 @@
+package starknettest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+var erc721Abi = starknet.MustParseAbi(`[
+	{
+		"type": "function",
+		"name": "token_uri",
+		"inputs": [{"name": "token_id", "type": "core::integer::u256"}],
+		"outputs": [{"type": "core::byte_array::ByteArray"}],
+		"state_mutability": "view"
+	}
+]`)
+
+// DeployCollection deploys an ERC721 whose token_uri returns uri(id) for
+// tokens in [min, max] and reverts for the others.
+func (n *Node) DeployCollection(address *felt.Felt, min int, max int, uri func(tokenId int) string) *Contract {
+	return n.Deploy(address).Handle("token_uri", func(calldata []felt.Felt) ([]felt.Felt, error) {
+		v, read, err := erc721Abi.Decode("core::integer::u256", calldata)
+		if err != nil || read != len(calldata) {
+			return nil, fmt.Errorf("Failed to deserialize param #1")
+		}
+		id := v.(*big.Int)
+		if !id.IsInt64() || id.Int64() < int64(min) || id.Int64() > int64(max) {
+			return nil, fmt.Errorf("ERC721: invalid token ID")
+		}
+		return starknet.EncodeByteArray(uri(int(id.Int64()))), nil
+	})
+}
+
+// Base64JsonUri is an on-chain metadata uri like the ones of Blobert
+func Base64JsonUri(tokenId int) string {
+	svg := fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><text y="10">%d</text></svg>`, tokenId)
+	metadata := fmt.Sprintf(`{"name":"Token #%d","description":"test token","image":"data:image/svg+xml;base64,%s","attributes":[{"trait_type":"Id","value":%d}]}`,
+		tokenId, base64.StdEncoding.EncodeToString([]byte(svg)), tokenId)
+	return "data:application/json;base64," + base64.StdEncoding.EncodeToString([]byte(metadata))
+}
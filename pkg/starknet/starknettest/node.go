@@ -0,0 +1,356 @@
+// Package starknettest provides an in-process Starknet JSON-RPC node for tests
+package starknettest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// EntryPoint answers a call with its result felts, an error is reported as a
+// revert carrying its message.
+type EntryPoint func(calldata []felt.Felt) ([]felt.Felt, error)
+
+type Contract struct {
+	Address   *felt.Felt
+	ClassHash *felt.Felt
+
+	mu          sync.Mutex
+	storage     map[felt.Felt]*felt.Felt
+	entryPoints map[felt.Felt]EntryPoint
+}
+
+// Handle registers fn for the entry point name, keyed by its StarknetKeccak selector
+func (c *Contract) Handle(name string, fn EntryPoint) *Contract {
+	selector, err := starknet.StarknetKeccak([]byte(name))
+	if err != nil {
+		panic(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entryPoints[*selector] = fn
+	return c
+}
+
+func (c *Contract) SetStorage(key *felt.Felt, value *felt.Felt) *Contract {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.storage[*key] = value
+	return c
+}
+
+func (c *Contract) entryPoint(selector *felt.Felt) (EntryPoint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fn, ok := c.entryPoints[*selector]
+	return fn, ok
+}
+
+func (c *Contract) storageAt(key *felt.Felt) *felt.Felt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.storage[*key]; ok {
+		return v
+	}
+	return new(felt.Felt)
+}
+
+// Node is a fake Starknet node serving deployed contracts over httptest. It
+// answers starknet_chainId, starknet_blockNumber, starknet_getBlockWithTxHashes,
+// starknet_call, starknet_getStorageAt, starknet_getNonce and
+// starknet_getClassHashAt, alone or in batches.
+type Node struct {
+	Server  *httptest.Server
+	Network starknet.StarknetNetwork
+
+	mu        sync.Mutex
+	block     uint64
+	contracts map[felt.Felt]*Contract
+	calls     map[string]int
+}
+
+// NewNode starts a mainnet node that is closed with the test
+func NewNode(t testing.TB) *Node {
+	n := &Node{
+		Network:   starknet.Mainnet,
+		contracts: make(map[felt.Felt]*Contract),
+		calls:     make(map[string]int),
+	}
+	n.Server = httptest.NewServer(http.HandlerFunc(n.serveHTTP))
+	t.Cleanup(n.Server.Close)
+	return n
+}
+
+func (n *Node) Url() string {
+	return n.Server.URL
+}
+
+// Client returns an rpc client for the node that does not wait between retries
+func (n *Node) Client() *starknet.JsonRpcStarknetClient {
+	c := starknet.NewJsonRpcStarknetClientWithProviders(n.Network, starknet.Provider{Url: n.Url()})
+	c.Retry = starknet.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	return c
+}
+
+// Deploy creates an empty contract at address
+func (n *Node) Deploy(address *felt.Felt) *Contract {
+	c := &Contract{
+		Address:     address,
+		ClassHash:   crypto.Poseidon(address, new(felt.Felt)),
+		storage:     make(map[felt.Felt]*felt.Felt),
+		entryPoints: make(map[felt.Felt]EntryPoint),
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.contracts[*address] = c
+	return c
+}
+
+// Mine advances the chain head by count blocks
+func (n *Node) Mine(count uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.block += count
+}
+
+// Calls returns how many times method was requested
+func (n *Node) Calls(method string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls[method]
+}
+
+// BlockHash of block number, derived from its number
+func BlockHash(number uint64) *felt.Felt {
+	return crypto.Poseidon(new(felt.Felt).SetUint64(number), new(felt.Felt).SetBytes([]byte("block")))
+}
+
+type request struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	Id      json.RawMessage `json:"id"`
+}
+
+type response struct {
+	JsonRpc string             `json:"jsonrpc"`
+	Result  any                `json:"result,omitempty"`
+	Error   *starknet.RpcError `json:"error,omitempty"`
+	Id      json.RawMessage    `json:"id"`
+}
+
+func (n *Node) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	if body = bytes.TrimSpace(body); len(body) > 0 && body[0] == '[' {
+		var requests []request
+		if err := json.Unmarshal(body, &requests); err != nil {
+			_ = json.NewEncoder(w).Encode(parseError(err))
+			return
+		}
+		responses := make([]response, len(requests))
+		for i, req := range requests {
+			responses[i] = n.handle(req)
+		}
+		_ = json.NewEncoder(w).Encode(responses)
+		return
+	}
+
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		_ = json.NewEncoder(w).Encode(parseError(err))
+		return
+	}
+	_ = json.NewEncoder(w).Encode(n.handle(req))
+}
+
+func parseError(err error) response {
+	return response{JsonRpc: "2.0", Error: &starknet.RpcError{Code: -32700, Message: "Parse error: " + err.Error()}, Id: json.RawMessage("null")}
+}
+
+func (n *Node) handle(req request) response {
+	n.mu.Lock()
+	n.calls[req.Method]++
+	n.mu.Unlock()
+
+	result, rpcErr := n.dispatch(req)
+	if rpcErr != nil {
+		return response{JsonRpc: "2.0", Error: rpcErr, Id: req.Id}
+	}
+	return response{JsonRpc: "2.0", Result: result, Id: req.Id}
+}
+
+type (
+	blockParams struct {
+		BlockId json.RawMessage `json:"block_id"`
+	}
+	callParams struct {
+		Request struct {
+			ContractAddress    *felt.Felt   `json:"contract_address"`
+			EntryPointSelector *felt.Felt   `json:"entry_point_selector"`
+			Calldata           []*felt.Felt `json:"calldata"`
+		} `json:"request"`
+	}
+	contractParams struct {
+		ContractAddress *felt.Felt `json:"contract_address"`
+		Key             *felt.Felt `json:"key"`
+	}
+)
+
+func invalidParams(err error) *starknet.RpcError {
+	return &starknet.RpcError{Code: -32602, Message: "Invalid params", Data: json.RawMessage(fmt.Sprintf("%q", err.Error()))}
+}
+
+func (n *Node) dispatch(req request) (any, *starknet.RpcError) {
+	switch req.Method {
+	case "starknet_chainId":
+		chainId, err := starknet.ChainId(n.Network)
+		if err != nil {
+			return nil, &starknet.RpcError{Code: -32603, Message: err.Error()}
+		}
+		return chainId, nil
+	case "starknet_blockNumber":
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		return n.block, nil
+	case "starknet_getBlockWithTxHashes":
+		var params blockParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return n.getBlock(params.BlockId)
+	case "starknet_call":
+		var params callParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return n.call(params)
+	case "starknet_getStorageAt", "starknet_getNonce", "starknet_getClassHashAt":
+		var params contractParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		c, rpcErr := n.contract(params.ContractAddress)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		switch req.Method {
+		case "starknet_getStorageAt":
+			if params.Key == nil {
+				return nil, invalidParams(fmt.Errorf("missing key"))
+			}
+			return c.storageAt(params.Key), nil
+		case "starknet_getNonce":
+			return new(felt.Felt), nil
+		}
+		return c.ClassHash, nil
+	}
+	return nil, &starknet.RpcError{Code: -32601, Message: "Method not found"}
+}
+
+func (n *Node) contract(address *felt.Felt) (*Contract, *starknet.RpcError) {
+	if address == nil {
+		return nil, invalidParams(fmt.Errorf("missing contract address"))
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	c, ok := n.contracts[*address]
+	if !ok {
+		return nil, &starknet.RpcError{Code: 20, Message: "Contract not found"}
+	}
+	return c, nil
+}
+
+func (n *Node) call(params callParams) (any, *starknet.RpcError) {
+	c, rpcErr := n.contract(params.Request.ContractAddress)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	if params.Request.EntryPointSelector == nil {
+		return nil, invalidParams(fmt.Errorf("missing entry point selector"))
+	}
+	fn, ok := c.entryPoint(params.Request.EntryPointSelector)
+	if !ok {
+		return nil, &starknet.RpcError{Code: 21, Message: "Requested entrypoint does not exist in the contract"}
+	}
+
+	calldata := make([]felt.Felt, len(params.Request.Calldata))
+	for i, f := range params.Request.Calldata {
+		calldata[i] = *f
+	}
+	result, err := fn(calldata)
+	if err != nil {
+		data, _ := json.Marshal(map[string]string{"revert_error": err.Error()})
+		return nil, &starknet.RpcError{Code: 40, Message: "Contract error", Data: data}
+	}
+	if result == nil {
+		result = []felt.Felt{}
+	}
+	return result, nil
+}
+
+func (n *Node) getBlock(blockId json.RawMessage) (any, *starknet.RpcError) {
+	n.mu.Lock()
+	head := n.block
+	n.mu.Unlock()
+
+	var tag string
+	var id struct {
+		BlockNumber *uint64    `json:"block_number"`
+		BlockHash   *felt.Felt `json:"block_hash"`
+	}
+	number := head
+	switch {
+	case json.Unmarshal(blockId, &tag) == nil:
+		if tag == string(starknet.BlockPending) {
+			return starknet.BlockWithTxHashes{BlockHeader: starknet.BlockHeader{ParentHash: BlockHash(head)}, Transactions: []*felt.Felt{}}, nil
+		}
+	case json.Unmarshal(blockId, &id) == nil && id.BlockNumber != nil:
+		number = *id.BlockNumber
+	case id.BlockHash != nil:
+		number = head + 1
+		for i := uint64(0); i <= head; i++ {
+			if BlockHash(i).Equal(id.BlockHash) {
+				number = i
+			}
+		}
+	default:
+		return nil, invalidParams(fmt.Errorf("invalid block id %s", blockId))
+	}
+	if number > head {
+		return nil, &starknet.RpcError{Code: 24, Message: "Block not found"}
+	}
+
+	parent := new(felt.Felt)
+	if number > 0 {
+		parent = BlockHash(number - 1)
+	}
+	return starknet.BlockWithTxHashes{
+		BlockHeader: starknet.BlockHeader{
+			BlockHash:        BlockHash(number),
+			ParentHash:       parent,
+			BlockNumber:      number,
+			NewRoot:          new(felt.Felt),
+			Timestamp:        1700000000 + number*30,
+			SequencerAddress: new(felt.Felt),
+			StarknetVersion:  "0.13.2",
+		},
+		Status:       "ACCEPTED_ON_L2",
+		Transactions: []*felt.Felt{},
+	}, nil
+}
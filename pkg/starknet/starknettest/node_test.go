@@ -0,0 +1,77 @@
+package starknettest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MartianGreed/memo-backend/pkg/starknet"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+)
+
+func TestNodeServesContracts(t *testing.T) {
+	ctx := context.Background()
+	node := NewNode(t)
+	address := starknet.FeltFromInt(0x539)
+	node.Deploy(address).
+		SetStorage(starknet.FeltFromInt(1), starknet.FeltFromInt(42)).
+		Handle("owner", func(calldata []felt.Felt) ([]felt.Felt, error) {
+			return []felt.Felt{*starknet.FeltFromInt(7)}, nil
+		})
+	node.Mine(5)
+	c := node.Client()
+
+	if err := c.VerifyChainId(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := c.BlockNumber(ctx); err != nil || n != 5 {
+		t.Fatalf("unexpected block number %d: %v", n, err)
+	}
+	block, err := c.GetBlockWithTxHashes(ctx, starknet.BlockNumberId(3))
+	if err != nil || !block.BlockHash.Equal(BlockHash(3)) || !block.ParentHash.Equal(BlockHash(2)) {
+		t.Fatalf("unexpected block %+v: %v", block, err)
+	}
+	if block, err := c.GetBlockWithTxHashes(ctx, starknet.BlockHashId(BlockHash(4))); err != nil || block.BlockNumber != 4 {
+		t.Fatalf("unexpected block %+v: %v", block, err)
+	}
+	if _, err := c.GetBlockWithTxHashes(ctx, starknet.BlockNumberId(6)); !errors.Is(err, starknet.ErrBlockNotFound) {
+		t.Fatalf("expected ErrBlockNotFound, got %v", err)
+	}
+	if v, err := c.GetStorageAt(ctx, address, starknet.FeltFromInt(1), starknet.BlockLatest); err != nil || v.Uint64() != 42 {
+		t.Fatalf("unexpected storage %v: %v", v, err)
+	}
+	if res, err := c.Call(ctx, address.String(), "owner", nil); err != nil || len(res) != 1 || res[0].Uint64() != 7 {
+		t.Fatalf("unexpected call result %v: %v", res, err)
+	}
+	if _, err := c.Call(ctx, address.String(), "burn", nil); !errors.Is(err, starknet.ErrEntrypointNotFound) {
+		t.Fatalf("expected ErrEntrypointNotFound, got %v", err)
+	}
+	if _, err := c.Call(ctx, "0x1", "owner", nil); !errors.Is(err, starknet.ErrContractNotFound) {
+		t.Fatalf("expected ErrContractNotFound, got %v", err)
+	}
+}
+
+func TestFakeCollection(t *testing.T) {
+	ctx := context.Background()
+	node := NewNode(t)
+	address := starknet.FeltFromInt(0xb10b)
+	node.DeployCollection(address, 1, 3, Base64JsonUri)
+	c := node.Client()
+
+	uri, err := starknet.GetTokenUri(ctx, c, address.String(), 2)
+	if err != nil || uri != Base64JsonUri(2) {
+		t.Fatalf("unexpected uri %q: %v", uri, err)
+	}
+	_, err = starknet.GetTokenUri(ctx, c, address.String(), 4)
+	if reason, ok := starknet.RevertReason(err); !ok || reason != "ERC721: invalid token ID" {
+		t.Fatalf("expected a revert, got %v", err)
+	}
+
+	uris, failed, err := starknet.GetTokenUris(ctx, c, address.String(), []int{1, 2, 3, 4})
+	if err != nil || len(uris) != 3 || len(failed) != 1 || failed[4] == nil {
+		t.Fatalf("unexpected batch result %v %v: %v", uris, failed, err)
+	}
+	if node.Calls("starknet_call") != 6 {
+		t.Fatalf("expected 6 calls, got %d", node.Calls("starknet_call"))
+	}
+}
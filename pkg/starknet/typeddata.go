@@ -0,0 +1,469 @@
+package starknet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+)
+
+// ErrInvalidTypedData is returned for typed data that can not be hashed
+var ErrInvalidTypedData = errors.New("invalid typed data")
+
+type (
+	TypedDataParam struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+		// Type of the enum, or of the merkletree leaves
+		Contains string `json:"contains,omitempty"`
+	}
+	// TypedData is a SNIP-12 message. Revision 0 hashes with Pedersen and
+	// revision 1, selected by the domain revision, with Poseidon.
+	TypedData struct {
+		Types       map[string][]TypedDataParam `json:"types"`
+		PrimaryType string                      `json:"primaryType"`
+		Domain      map[string]any              `json:"domain"`
+		Message     map[string]any              `json:"message"`
+	}
+)
+
+var (
+	u128Bound = new(big.Int).Lsh(big.NewInt(1), 128)
+	i128Bound = new(big.Int).Lsh(big.NewInt(1), 127)
+
+	// types every revision 1 message may use without declaring them
+	presetTypes = map[string][]TypedDataParam{
+		"u256": {
+			{Name: "low", Type: "u128"},
+			{Name: "high", Type: "u128"},
+		},
+		"TokenAmount": {
+			{Name: "token_address", Type: "ContractAddress"},
+			{Name: "amount", Type: "u256"},
+		},
+		"NftId": {
+			{Name: "collection_address", Type: "ContractAddress"},
+			{Name: "token_id", Type: "u256"},
+		},
+	}
+)
+
+// ParseTypedData reads a SNIP-12 json document, numbers are kept exact
+func ParseTypedData(b []byte) (*TypedData, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var td TypedData
+	if err := d.Decode(&td); err != nil {
+		return nil, errors.Mark(err, ErrInvalidTypedData)
+	}
+	if err := td.Validate(); err != nil {
+		return nil, err
+	}
+	return &td, nil
+}
+
+func (td *TypedData) Validate() error {
+	if _, ok := td.Types[td.domainType()]; !ok {
+		return errors.Wrapf(ErrInvalidTypedData, "missing %s type", td.domainType())
+	}
+	if _, ok := td.Types[td.PrimaryType]; !ok {
+		return errors.Wrapf(ErrInvalidTypedData, "missing primary type %s", td.PrimaryType)
+	}
+	return nil
+}
+
+// Revision is 1 when the domain declares it, 0 otherwise
+func (td *TypedData) Revision() int {
+	switch fmt.Sprint(td.Domain["revision"]) {
+	case "1":
+		return 1
+	}
+	return 0
+}
+
+func (td *TypedData) domainType() string {
+	if td.Revision() == 1 {
+		return "StarknetDomain"
+	}
+	return "StarkNetDomain"
+}
+
+func (td *TypedData) hash(elements ...*felt.Felt) *felt.Felt {
+	if td.Revision() == 1 {
+		return crypto.PoseidonArray(elements...)
+	}
+	return crypto.PedersenArray(elements...)
+}
+
+func (td *TypedData) merkleHash(a *felt.Felt, b *felt.Felt) *felt.Felt {
+	if a.Cmp(b) > 0 {
+		a, b = b, a
+	}
+	if td.Revision() == 1 {
+		return crypto.Poseidon(a, b)
+	}
+	return crypto.Pedersen(a, b)
+}
+
+func (td *TypedData) lookup(name string) ([]TypedDataParam, bool) {
+	if params, ok := td.Types[name]; ok {
+		return params, true
+	}
+	if td.Revision() == 1 {
+		params, ok := presetTypes[name]
+		return params, ok
+	}
+	return nil, false
+}
+
+// dependencies lists typ followed by every type it references, depth first
+func (td *TypedData) dependencies(typ string, contains string, seen []string) []string {
+	candidates := []string{typ}
+	switch {
+	case strings.HasSuffix(typ, "*"):
+		candidates = []string{strings.TrimSuffix(typ, "*")}
+	case td.Revision() == 1 && typ == "enum":
+		candidates = []string{contains}
+	case td.Revision() == 1 && strings.HasPrefix(typ, "(") && strings.HasSuffix(typ, ")"):
+		candidates = nil
+		for _, t := range strings.Split(typ[1:len(typ)-1], ",") {
+			candidates = append(candidates, strings.TrimSuffix(t, "*"))
+		}
+	}
+
+	for _, c := range candidates {
+		params, ok := td.lookup(c)
+		if !ok || containsString(seen, c) {
+			continue
+		}
+		seen = append(seen, c)
+		for _, p := range params {
+			seen = td.dependencies(p.Type, p.Contains, seen)
+		}
+	}
+	return seen
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// EncodeType returns the type string hashed into the type hash, the primary
+// type first then its dependencies sorted by name.
+func (td *TypedData) EncodeType(typ string) (string, error) {
+	if _, ok := td.lookup(typ); !ok {
+		return "", errors.Wrapf(ErrInvalidTypedData, "unknown type %s", typ)
+	}
+	deps := td.dependencies(typ, "", nil)
+	sort.Strings(deps[1:])
+
+	esc := func(s string) string { return s }
+	if td.Revision() == 1 {
+		esc = func(s string) string { return `"` + s + `"` }
+	}
+
+	var b strings.Builder
+	for _, dep := range deps {
+		params, _ := td.lookup(dep)
+		fields := make([]string, len(params))
+		for i, p := range params {
+			target := p.Type
+			if td.Revision() == 1 && p.Type == "enum" {
+				target = p.Contains
+			}
+			if strings.HasPrefix(target, "(") && strings.HasSuffix(target, ")") {
+				parts := strings.Split(target[1:len(target)-1], ",")
+				for j, part := range parts {
+					if part != "" {
+						parts[j] = esc(part)
+					}
+				}
+				target = "(" + strings.Join(parts, ",") + ")"
+			} else {
+				target = esc(target)
+			}
+			fields[i] = esc(p.Name) + ":" + target
+		}
+		b.WriteString(esc(dep) + "(" + strings.Join(fields, ",") + ")")
+	}
+	return b.String(), nil
+}
+
+func (td *TypedData) TypeHash(typ string) (*felt.Felt, error) {
+	encoded, err := td.EncodeType(typ)
+	if err != nil {
+		return nil, err
+	}
+	return StarknetKeccak([]byte(encoded))
+}
+
+// StructHash hashes the type hash of typ followed by every encoded field of data
+func (td *TypedData) StructHash(typ string, data map[string]any) (*felt.Felt, error) {
+	params, ok := td.lookup(typ)
+	if !ok {
+		return nil, errors.Wrapf(ErrInvalidTypedData, "unknown type %s", typ)
+	}
+	typeHash, err := td.TypeHash(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	elements := []*felt.Felt{typeHash}
+	for _, p := range params {
+		value, ok := data[p.Name]
+		if !ok || (value == nil && p.Type != "enum") {
+			return nil, errors.Wrapf(ErrInvalidTypedData, "%s: missing %s", typ, p.Name)
+		}
+		encoded, err := td.encodeValue(p, value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s.%s", typ, p.Name)
+		}
+		elements = append(elements, encoded)
+	}
+	return td.hash(elements...), nil
+}
+
+// MessageHash is the hash signed by account
+func (td *TypedData) MessageHash(account *felt.Felt) (*felt.Felt, error) {
+	domainHash, err := td.StructHash(td.domainType(), td.Domain)
+	if err != nil {
+		return nil, err
+	}
+	messageHash, err := td.StructHash(td.PrimaryType, td.Message)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := EncodeShortString("StarkNet Message")
+	if err != nil {
+		return nil, err
+	}
+	return td.hash(prefix, domainHash, account, messageHash), nil
+}
+
+// Verify checks a [r, s] signature of the message by account against the stark
+// public key of its signer.
+func (td *TypedData) Verify(account *felt.Felt, publicKey *felt.Felt, signature []*felt.Felt) (bool, error) {
+	if len(signature) != 2 {
+		return false, errors.Newf("expected a [r, s] signature, got %d felts", len(signature))
+	}
+	msgHash, err := td.MessageHash(account)
+	if err != nil {
+		return false, err
+	}
+	pub := crypto.NewPublicKey(publicKey)
+	return pub.Verify(&crypto.Signature{R: *signature[0], S: *signature[1]}, msgHash)
+}
+
+func (td *TypedData) encodeValue(p TypedDataParam, value any) (*felt.Felt, error) {
+	if _, ok := td.lookup(p.Type); ok {
+		data, ok := value.(map[string]any)
+		if !ok {
+			return nil, errors.Wrapf(ErrInvalidTypedData, "%s: expected an object, got %T", p.Type, value)
+		}
+		return td.StructHash(p.Type, data)
+	}
+
+	if strings.HasSuffix(p.Type, "*") {
+		values, ok := value.([]any)
+		if !ok {
+			return nil, errors.Wrapf(ErrInvalidTypedData, "%s: expected an array, got %T", p.Type, value)
+		}
+		elements := make([]*felt.Felt, len(values))
+		for i, v := range values {
+			encoded, err := td.encodeValue(TypedDataParam{Type: strings.TrimSuffix(p.Type, "*")}, v)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = encoded
+		}
+		return td.hash(elements...), nil
+	}
+
+	rev1 := td.Revision() == 1
+	switch p.Type {
+	case "enum":
+		if rev1 {
+			return td.encodeEnum(p.Contains, value)
+		}
+	case "merkletree":
+		return td.merkleRoot(p.Contains, value)
+	case "selector":
+		if s, ok := value.(string); ok && !strings.HasPrefix(s, "0x") {
+			return StarknetKeccak([]byte(s))
+		}
+	case "string":
+		if rev1 {
+			s, ok := value.(string)
+			if !ok {
+				return nil, errors.Wrapf(ErrInvalidTypedData, "string: got %T", value)
+			}
+			data := EncodeByteArray(s)
+			elements := make([]*felt.Felt, len(data))
+			for i := range data {
+				elements[i] = &data[i]
+			}
+			return td.hash(elements...), nil
+		}
+	case "bool":
+		if rev1 {
+			return typedInt(value, big.NewInt(0), big.NewInt(2))
+		}
+	case "u128", "timestamp":
+		if rev1 {
+			return typedInt(value, big.NewInt(0), u128Bound)
+		}
+	case "i128":
+		if rev1 {
+			return typedInt(value, new(big.Int).Neg(i128Bound), i128Bound)
+		}
+	}
+	return typedFelt(value)
+}
+
+// encodeEnum hashes the variant index followed by its encoded fields, the value is {"Variant": [fields...]}
+// or {"Variant": []} for a unit variant
+func (td *TypedData) encodeEnum(enum string, value any) (*felt.Felt, error) {
+	variants, ok := td.lookup(enum)
+	data, isObject := value.(map[string]any)
+	if !ok || !isObject || len(data) != 1 {
+		return nil, errors.Wrapf(ErrInvalidTypedData, "enum %s: expected a single variant", enum)
+	}
+	for name, fields := range data {
+		for i, variant := range variants {
+			if variant.Name != name {
+				continue
+			}
+			elements := []*felt.Felt{new(felt.Felt).SetUint64(uint64(i))}
+			inner := strings.TrimSuffix(strings.TrimPrefix(variant.Type, "("), ")")
+			if inner == "" {
+				// starknet.js encodes the empty tuple as a single zero field
+				return td.hash(append(elements, new(felt.Felt))...), nil
+			}
+			values, _ := fields.([]any)
+			types := strings.Split(inner, ",")
+			if len(values) != len(types) {
+				return nil, errors.Wrapf(ErrInvalidTypedData, "enum %s: variant %s expects %d values", enum, name, len(types))
+			}
+			for j, typ := range types {
+				encoded, err := td.encodeValue(TypedDataParam{Type: typ}, values[j])
+				if err != nil {
+					return nil, err
+				}
+				elements = append(elements, encoded)
+			}
+			return td.hash(elements...), nil
+		}
+		return nil, errors.Wrapf(ErrInvalidTypedData, "enum %s: unknown variant %s", enum, name)
+	}
+	return nil, nil
+}
+
+// merkleRoot builds a tree of sorted pair hashes over the encoded leaves
+func (td *TypedData) merkleRoot(leafType string, value any) (*felt.Felt, error) {
+	values, ok := value.([]any)
+	if !ok || len(values) == 0 {
+		return nil, errors.Wrapf(ErrInvalidTypedData, "merkletree: expected a non empty array")
+	}
+	level := make([]*felt.Felt, len(values))
+	for i, v := range values {
+		leaf, err := td.encodeValue(TypedDataParam{Type: leafType}, v)
+		if err != nil {
+			return nil, err
+		}
+		level[i] = leaf
+	}
+	for len(level) > 1 {
+		var next []*felt.Felt
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, td.merkleHash(level[i], new(felt.Felt)))
+			} else {
+				next = append(next, td.merkleHash(level[i], level[i+1]))
+			}
+		}
+		level = next
+	}
+	return level[0], nil
+}
+
+// typedFelt reads a number, a hex or decimal string, or a short string
+func typedFelt(value any) (*felt.Felt, error) {
+	switch v := value.(type) {
+	case *felt.Felt:
+		if v == nil {
+			return nil, errors.Wrap(ErrInvalidTypedData, "nil felt")
+		}
+		return v, nil
+	case felt.Felt:
+		return &v, nil
+	case bool:
+		if v {
+			return new(felt.Felt).SetUint64(1), nil
+		}
+		return new(felt.Felt), nil
+	case json.Number:
+		return typedFelt(string(v))
+	case string:
+		if n, ok := new(big.Int).SetString(v, 0); ok && n.Sign() >= 0 {
+			f := new(felt.Felt).SetBigInt(n)
+			if f.BigInt(new(big.Int)).Cmp(n) != 0 {
+				return nil, errors.Wrapf(ErrInvalidTypedData, "%s does not fit in a felt", v)
+			}
+			return f, nil
+		}
+		f, err := EncodeShortString(v)
+		return f, errors.Mark(err, ErrInvalidTypedData)
+	}
+	n, err := toBig(value)
+	if err != nil {
+		return nil, errors.Mark(err, ErrInvalidTypedData)
+	}
+	return new(felt.Felt).SetBigInt(n), nil
+}
+
+// typedInt reads an integer in [min, max), negative values wrap around the field
+func typedInt(value any, min *big.Int, max *big.Int) (*felt.Felt, error) {
+	var n *big.Int
+	switch v := value.(type) {
+	case bool:
+		n = big.NewInt(0)
+		if v {
+			n.SetInt64(1)
+		}
+	case json.Number:
+		var ok bool
+		if n, ok = new(big.Int).SetString(string(v), 10); !ok {
+			return nil, errors.Wrapf(ErrInvalidTypedData, "invalid integer %s", v)
+		}
+	case string:
+		var ok bool
+		if n, ok = new(big.Int).SetString(v, 0); !ok {
+			return nil, errors.Wrapf(ErrInvalidTypedData, "invalid integer %q", v)
+		}
+	case int:
+		n = big.NewInt(int64(v))
+	case int64:
+		n = big.NewInt(v)
+	default:
+		f, err := typedFelt(value)
+		if err != nil {
+			return nil, err
+		}
+		n = f.BigInt(new(big.Int))
+	}
+	if n.Cmp(min) < 0 || n.Cmp(max) >= 0 {
+		return nil, errors.Wrapf(ErrInvalidTypedData, "%s is out of range [%s, %s)", n, min, max)
+	}
+	return new(felt.Felt).SetBigInt(n), nil
+}
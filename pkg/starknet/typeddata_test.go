@@ -0,0 +1,388 @@
+package starknet
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/MartianGreed/memo-backend/pkg/signer"
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/cockroachdb/errors"
+)
+
+// typedDataExample.json of starknet.js
+const mailTypedData = `{
+	"types": {
+		"StarkNetDomain": [
+			{ "name": "name", "type": "felt" },
+			{ "name": "version", "type": "felt" },
+			{ "name": "chainId", "type": "felt" }
+		],
+		"Person": [
+			{ "name": "name", "type": "felt" },
+			{ "name": "wallet", "type": "felt" }
+		],
+		"Mail": [
+			{ "name": "from", "type": "Person" },
+			{ "name": "to", "type": "Person" },
+			{ "name": "contents", "type": "felt" }
+		]
+	},
+	"primaryType": "Mail",
+	"domain": { "name": "StarkNet Mail", "version": "1", "chainId": 1 },
+	"message": {
+		"from": { "name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826" },
+		"to": { "name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB" },
+		"contents": "Hello, Bob!"
+	}
+}`
+
+const moveTypedData = `{
+	"types": {
+		"StarknetDomain": [
+			{ "name": "name", "type": "shortstring" },
+			{ "name": "version", "type": "shortstring" },
+			{ "name": "chainId", "type": "shortstring" },
+			{ "name": "revision", "type": "shortstring" }
+		],
+		"Move": [
+			{ "name": "game", "type": "felt" },
+			{ "name": "label", "type": "string" },
+			{ "name": "index", "type": "u128" },
+			{ "name": "stake", "type": "u256" },
+			{ "name": "side", "type": "enum", "contains": "Side" },
+			{ "name": "allowed", "type": "merkletree", "contains": "felt" }
+		],
+		"Side": [
+			{ "name": "Left", "type": "()" },
+			{ "name": "Right", "type": "(u128,bool)" }
+		]
+	},
+	"primaryType": "Move",
+	"domain": { "name": "memo", "version": "1", "chainId": "SN_SEPOLIA", "revision": "1" },
+	"message": {
+		"game": "0x2a",
+		"label": "a label that does not fit in a single short string",
+		"index": 3,
+		"stake": { "low": "1000", "high": "0" },
+		"side": { "Right": [7, true] },
+		"allowed": ["0x1", "0x2", "0x3"]
+	}
+}`
+
+func parseTypedData(t *testing.T, s string) *TypedData {
+	t.Helper()
+	td, err := ParseTypedData([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return td
+}
+
+func TestTypedDataRevision0(t *testing.T) {
+	td := parseTypedData(t, mailTypedData)
+	if td.Revision() != 0 {
+		t.Fatalf("expected revision 0, got %d", td.Revision())
+	}
+
+	encoded, err := td.EncodeType("Mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Mail(from:Person,to:Person,contents:felt)Person(name:felt,wallet:felt)"; encoded != expected {
+		t.Fatalf("expected %s, got %s", expected, encoded)
+	}
+
+	for typ, expected := range map[string]string{
+		"StarkNetDomain": "0x1bfc207425a47a5dfa1a50a4f5241203f50624ca5fdf5e18755765416b8e288",
+		"Person":         "0x2896dbe4b96a67110f454c01e5336edc5bbc3635537efd690f122f4809cc855",
+		"Mail":           "0x13d89452df9512bf750f539ba3001b945576243288137ddb6c788457d4b2f79",
+	} {
+		h, err := td.TypeHash(typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.String() != expected {
+			t.Errorf("%s: expected type hash %s, got %s", typ, expected, h)
+		}
+	}
+
+	h, err := td.MessageHash(feltFromHex(t, "0xcd2a3d9f938e13cd947ec05abc7fe734df8dd826"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "0x6fcff244f63e38b9d88b9e3378d44757710d1b244282b435cb472053c8d78d0"; h.String() != expected {
+		t.Fatalf("expected message hash %s, got %s", expected, h)
+	}
+}
+
+func TestTypedDataRevision1(t *testing.T) {
+	td := parseTypedData(t, moveTypedData)
+	if td.Revision() != 1 {
+		t.Fatalf("expected revision 1, got %d", td.Revision())
+	}
+
+	// constants of the OpenZeppelin snip12 implementation
+	for typ, expected := range map[string]string{
+		"StarknetDomain": "0x1ff2f602e42168014d405a94f75e8a93d640751d71d16311266e140d8b0a210",
+		"u256":           "0x3b143be38b811560b45593fb2a071ec4ddd0a020e10782be62ffe6f39e0e82c",
+	} {
+		h, err := td.TypeHash(typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.String() != expected {
+			t.Errorf("%s: expected type hash %s, got %s", typ, expected, h)
+		}
+	}
+
+	encoded, err := td.EncodeType("Move")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `"Move"("game":"felt","label":"string","index":"u128","stake":"u256","side":"Side","allowed":"merkletree")` +
+		`"Side"("Left":(),"Right":("u128","bool"))"u256"("low":"u128","high":"u128")`
+	if encoded != expected {
+		t.Fatalf("expected %s, got %s", expected, encoded)
+	}
+
+	if _, err := td.MessageHash(new(felt.Felt).SetUint64(1)); err != nil {
+		t.Fatal(err)
+	}
+	td.Message["index"] = "0x100000000000000000000000000000000"
+	if _, err := td.MessageHash(new(felt.Felt).SetUint64(1)); !errors.Is(err, ErrInvalidTypedData) {
+		t.Fatalf("expected an out of range u128 to be rejected, got %v", err)
+	}
+}
+
+// revision 1 examples of the starknet.js test suite, they share this domain
+const (
+	exampleDomainType = `"StarknetDomain": [
+		{ "name": "name", "type": "shortstring" },
+		{ "name": "version", "type": "shortstring" },
+		{ "name": "chainId", "type": "shortstring" },
+		{ "name": "revision", "type": "shortstring" }
+	]`
+	exampleDomain = `"domain": { "name": "StarkNet Mail", "version": "1", "chainId": "1", "revision": "1" }`
+
+	exampleBaseTypes = `{
+	"types": {` + exampleDomainType + `,
+		"Example": [
+			{ "name": "n0", "type": "felt" },
+			{ "name": "n1", "type": "bool" },
+			{ "name": "n2", "type": "string" },
+			{ "name": "n3", "type": "selector" },
+			{ "name": "n4", "type": "u128" },
+			{ "name": "n5", "type": "i128" },
+			{ "name": "n6", "type": "ContractAddress" },
+			{ "name": "n7", "type": "ClassHash" },
+			{ "name": "n8", "type": "timestamp" },
+			{ "name": "n9", "type": "shortstring" }
+		]
+	},
+	"primaryType": "Example",` + exampleDomain + `,
+	"message": {
+		"n0": "0x3e8",
+		"n1": true,
+		"n2": "A1",
+		"n3": "transfer",
+		"n4": "0x3e8",
+		"n5": "-170141183460469231731687303715884105727",
+		"n6": "0x3e8",
+		"n7": "0x3e8",
+		"n8": 1000,
+		"n9": "transfer"
+	}
+}`
+
+	examplePresetTypes = `{
+	"types": {` + exampleDomainType + `,
+		"Example": [
+			{ "name": "n0", "type": "TokenAmount" },
+			{ "name": "n1", "type": "NftId" }
+		]
+	},
+	"primaryType": "Example",` + exampleDomain + `,
+	"message": {
+		"n0": { "token_address": "0x0123", "amount": { "low": "0x3e8", "high": "0x0" } },
+		"n1": { "collection_address": "0x0123", "token_id": { "low": "0x3e8", "high": "0x0" } }
+	}
+}`
+
+	exampleEnum = `{
+	"types": {` + exampleDomainType + `,
+		"Example": [{ "name": "someEnum", "type": "enum", "contains": "MyEnum" }],
+		"MyEnum": [
+			{ "name": "Variant 1", "type": "()" },
+			{ "name": "Variant 2", "type": "(u128,u128*)" },
+			{ "name": "Variant 3", "type": "(u128)" }
+		]
+	},
+	"primaryType": "Example",` + exampleDomain + `,
+	"message": { "someEnum": { "Variant 2": [2, [0, 1]] } }
+}`
+
+	// not from starknet.js, covers strings longer than a word and merkle trees
+	exampleMerkleTree = `{
+	"types": {` + exampleDomainType + `,
+		"Example": [
+			{ "name": "label", "type": "string" },
+			{ "name": "allowed", "type": "merkletree", "contains": "felt" }
+		]
+	},
+	"primaryType": "Example",` + exampleDomain + `,
+	"message": {
+		"label": "a label that does not fit in a single short string",
+		"allowed": ["0x1", "0x2", "0x3"]
+	}
+}`
+)
+
+// TestTypedDataRevision1Encoding checks full message hashes against the SNIP-12
+// encoding spelled out field by field, the way starknet.js applies it. Only the
+// type hashes of its examples are reference values, see TestTypedDataRevision1.
+func TestTypedDataRevision1Encoding(t *testing.T) {
+	account := feltFromHex(t, "0xcd2a3d9f938e13cd947ec05abc7fe734df8dd826")
+	domainHash := feltFromHex(t, "0x555f72e550b308e50c1a4f8611483a174026c982a9893a05c185eeb85399657")
+	poseidon := crypto.PoseidonArray
+	short := func(s string) *felt.Felt { return new(felt.Felt).SetBytes([]byte(s)) }
+	n := func(v uint64) *felt.Felt { return new(felt.Felt).SetUint64(v) }
+	keccak := func(s string) *felt.Felt {
+		h, err := StarknetKeccak([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	u256 := func(low uint64) *felt.Felt {
+		return poseidon(feltFromHex(t, "0x3b143be38b811560b45593fb2a071ec4ddd0a020e10782be62ffe6f39e0e82c"), n(low), n(0))
+	}
+	u256Type := `"u256"("low":"u128","high":"u128")`
+
+	label := "a label that does not fit in a single short string"
+	pairHash := func(a, b *felt.Felt) *felt.Felt {
+		if a.Cmp(b) > 0 {
+			a, b = b, a
+		}
+		return crypto.Poseidon(a, b)
+	}
+
+	for name, tc := range map[string]struct {
+		doc      string
+		expected *felt.Felt
+	}{
+		"base types": {exampleBaseTypes, poseidon(
+			feltFromHex(t, "0x1f94cd0be8b4097a41486170fdf09a4cd23aefbc74bb2344718562994c2c111"),
+			n(1000),
+			n(1),
+			// byte array of "A1": no full word, the pending word and its length
+			poseidon(n(0), short("A1"), n(2)),
+			keccak("transfer"),
+			n(1000),
+			new(felt.Felt).Sub(new(felt.Felt), feltFromHex(t, "0x7fffffffffffffffffffffffffffffff")),
+			n(1000),
+			n(1000),
+			n(1000),
+			short("transfer"),
+		)},
+		"preset types": {examplePresetTypes, poseidon(
+			feltFromHex(t, "0x1a25a8bb84b761090b1fadaebe762c4b679b0d8883d2bedda695ea340839a55"),
+			poseidon(keccak(`"TokenAmount"("token_address":"ContractAddress","amount":"u256")`+u256Type), n(0x123), u256(1000)),
+			poseidon(keccak(`"NftId"("collection_address":"ContractAddress","token_id":"u256")`+u256Type), n(0x123), u256(1000)),
+		)},
+		"enum": {exampleEnum, poseidon(
+			feltFromHex(t, "0x380a54d417fb58913b904675d94a8a62e2abc3467f4b5439de0fd65fafdd1a8"),
+			// second variant, then its fields
+			poseidon(n(1), n(2), poseidon(n(0), n(1))),
+		)},
+		"unit enum variant": {strings.Replace(exampleEnum, `{ "Variant 2": [2, [0, 1]] }`, `{ "Variant 1": [] }`, 1), poseidon(
+			feltFromHex(t, "0x380a54d417fb58913b904675d94a8a62e2abc3467f4b5439de0fd65fafdd1a8"),
+			// the empty tuple is a single zero field
+			poseidon(n(0), n(0)),
+		)},
+		"merkletree": {exampleMerkleTree, poseidon(
+			keccak(`"Example"("label":"string","allowed":"merkletree")`),
+			poseidon(n(1), short(label[:31]), short(label[31:]), n(uint64(len(label)-31))),
+			pairHash(pairHash(n(1), n(2)), pairHash(n(3), n(0))),
+		)},
+	} {
+		td := parseTypedData(t, tc.doc)
+		h, err := td.MessageHash(account)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if expected := poseidon(short("StarkNet Message"), domainHash, account, tc.expected); !h.Equal(expected) {
+			t.Errorf("%s: expected message hash %s, got %s", name, expected, h)
+		}
+	}
+}
+
+func TestTypedDataDomainSeparation(t *testing.T) {
+	account := new(felt.Felt).SetUint64(0xacc)
+	td := parseTypedData(t, moveTypedData)
+	h, err := td.MessageHash(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	td.Domain["chainId"] = "SN_MAIN"
+	other, err := td.MessageHash(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Equal(other) {
+		t.Fatal("message hash does not depend on the chain id")
+	}
+
+	otherAccount, err := parseTypedData(t, moveTypedData).MessageHash(new(felt.Felt).SetUint64(0xbee))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Equal(otherAccount) {
+		t.Fatal("message hash does not depend on the account")
+	}
+}
+
+func TestTypedDataVerify(t *testing.T) {
+	key, err := signer.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := new(felt.Felt).SetUint64(0xacc)
+	td := parseTypedData(t, moveTypedData)
+	h, err := td.MessageHash(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := key.Sign(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := td.Verify(account, key.PublicKey(), []*felt.Felt{&sig.R, &sig.S})
+	if err != nil || !ok {
+		t.Fatalf("expected the signature to verify, got %v %v", ok, err)
+	}
+
+	td.Message["index"] = 4
+	ok, err = td.Verify(account, key.PublicKey(), []*felt.Felt{&sig.R, &sig.S})
+	if err != nil || ok {
+		t.Fatalf("expected a tampered message to be rejected, got %v %v", ok, err)
+	}
+}
+
+func TestParseTypedDataRequiresDomain(t *testing.T) {
+	_, err := ParseTypedData([]byte(`{"types":{"Mail":[]},"primaryType":"Mail","domain":{},"message":{}}`))
+	if !errors.Is(err, ErrInvalidTypedData) {
+		t.Fatalf("expected ErrInvalidTypedData, got %v", err)
+	}
+}
+
+func feltFromHex(t *testing.T, s string) *felt.Felt {
+	t.Helper()
+	f, err := new(felt.Felt).SetString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("OTEL_TRACES_EXPORTER", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_SERVICE_NAME", "")
+	if cfg := ConfigFromEnv(); cfg.Exporter != ExporterNone || cfg.ServiceName != defaultServiceName {
+		t.Fatalf("unexpected default config %+v", cfg)
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318")
+	if cfg := ConfigFromEnv(); cfg.Exporter != ExporterOtlp {
+		t.Fatalf("expected otlp with an endpoint, got %s", cfg.Exporter)
+	}
+	t.Setenv("OTEL_TRACES_EXPORTER", "stdout")
+	if cfg := ConfigFromEnv(); cfg.Exporter != ExporterStdout {
+		t.Fatalf("expected the exporter to be picked explicitly, got %s", cfg.Exporter)
+	}
+}
+
+func TestSetupStdout(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	var out bytes.Buffer
+	shutdown, err := Setup(context.Background(), Config{ServiceName: "memo-test", Exporter: ExporterStdout, Output: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := Tracer().Start(context.Background(), "test.span")
+	span.End()
+	// shutdown flushes the batch
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"Name":"test.span"`, `"Value":"memo-test"`} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %s in the exported spans, got %s", want, out.String())
+		}
+	}
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), Config{Exporter: "zipkin"}); err == nil {
+		t.Fatal("expected an error")
+	}
+}